@@ -2,7 +2,10 @@ module github.com/huffmanks/stash
 
 go 1.25.5
 
-require github.com/yarlson/tap v0.11.0
+require (
+	github.com/yarlson/tap v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/clipperhouse/stringish v0.1.1 // indirect
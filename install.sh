@@ -5,6 +5,8 @@ set -e
 REPO="huffmanks/stash"
 APP_NAME="stash"
 FORCE_INSTALL=false
+USER_INSTALL=false
+INSTALL_DIR="${STASH_INSTALL_DIR:-}"
 
 for arg in "$@"; do
   case $arg in
@@ -12,9 +14,40 @@ for arg in "$@"; do
       FORCE_INSTALL=true
       shift
       ;;
+    -u|--user)
+      USER_INSTALL=true
+      shift
+      ;;
   esac
 done
 
+# can_sudo reports whether this user may actually run sudo, not just whether
+# it is installed. On a shared box sudo is often there without the user being
+# in sudoers; asking for the password once tells the two apart.
+can_sudo() {
+    command -v sudo >/dev/null 2>&1 || return 1
+    sudo -n true 2>/dev/null && return 0
+    [ -r /dev/tty ] && sudo -v 2>/dev/null </dev/tty
+}
+
+# Install system wide when possible. Without sudo rights, or with --user,
+# stash goes to ~/.local/bin, which needs no root.
+if [ -z "$INSTALL_DIR" ]; then
+    if [ "$USER_INSTALL" = true ]; then
+        INSTALL_DIR="$HOME/.local/bin"
+    elif [ -w /usr/local/bin ] || can_sudo; then
+        INSTALL_DIR="/usr/local/bin"
+    else
+        echo "No sudo rights, installing to ~/.local/bin instead."
+        INSTALL_DIR="$HOME/.local/bin"
+    fi
+fi
+
+SUDO=""
+if ! mkdir -p "$INSTALL_DIR" 2>/dev/null || [ ! -w "$INSTALL_DIR" ]; then
+    SUDO="sudo"
+fi
+
 VERSION=$(curl -s "https://api.github.com/repos/${REPO}/releases/latest" | grep '"tag_name":' | sed -E 's/.*"([^"]+)".*/\1/')
 
 if command -v stash >/dev/null 2>&1; then
@@ -51,14 +84,21 @@ curl -L -o stash.tar.gz "${DOWNLOAD_URL}"
 tar -xzf stash.tar.gz stash
 chmod +x stash
 
-sudo mkdir -p /usr/local/bin
-sudo mv -f stash /usr/local/bin/stash
+$SUDO mkdir -p "$INSTALL_DIR"
+$SUDO mv -f stash "$INSTALL_DIR/stash"
 
 if [ "$OS" = "darwin" ]; then
-    sudo xattr -d com.apple.quarantine /usr/local/bin/stash 2>/dev/null || true
+    $SUDO xattr -d com.apple.quarantine "$INSTALL_DIR/stash" 2>/dev/null || true
 fi
 
 rm stash.tar.gz
 
-echo "✅ stash installed to /usr/local/bin/stash"
-stash --version
+echo "✅ stash installed to $INSTALL_DIR/stash"
+
+case ":$PATH:" in
+    *":$INSTALL_DIR:"*) ;;
+    *) echo "⚠️  $INSTALL_DIR is not on your PATH. Add it to your shell profile:"
+       echo "   export PATH=\"$INSTALL_DIR:\$PATH\"" ;;
+esac
+
+"$INSTALL_DIR/stash" --version
@@ -0,0 +1,30 @@
+# =====================================
+# Config (common)
+# =====================================
+
+export TZ={{shquote .timezone}}
+{{- if .editor}}
+export EDITOR={{shquote .editor}}
+export VISUAL={{shquote .editor}}
+{{- end}}
+{{- if .extra_path}}
+export PATH="$PATH":{{shpath .extra_path}}
+{{- end}}
+
+if [ "$TERM" = "xterm" ]; then
+  export TERM="xterm-256color"
+fi
+
+# ----- bash config -----
+HISTFILE=~/.bash_history
+HISTSIZE={{shquote .history_size}}
+HISTFILESIZE={{shquote .history_size}}
+HISTCONTROL=ignoredups:erasedups
+HISTTIMEFORMAT="%F %T "
+
+shopt -s histappend
+shopt -s checkwinsize
+shopt -s cmdhist
+
+# Share history between sessions
+PROMPT_COMMAND="history -a; history -n${PROMPT_COMMAND:+; $PROMPT_COMMAND}"
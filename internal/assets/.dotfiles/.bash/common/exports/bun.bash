@@ -0,0 +1,3 @@
+# ----- Bun -----
+export BUN_INSTALL="$HOME/.bun"
+export PATH="$BUN_INSTALL/bin:$PATH"
@@ -0,0 +1,2 @@
+# ----- Docker -----
+[ -s "$HOME/.docker/completions/docker.bash" ] && source "$HOME/.docker/completions/docker.bash"
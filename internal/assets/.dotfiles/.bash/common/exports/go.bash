@@ -0,0 +1,2 @@
+# ----- Golang -----
+export PATH=$PATH:$HOME/go/bin
@@ -0,0 +1,2 @@
+# ----- PIPX -----
+export PATH="$HOME/.local/bin:$PATH"
@@ -0,0 +1,48 @@
+# =====================================
+# Prompt (common)
+# =====================================
+
+# ----- Git info -----
+get_git_info() {
+  # Check if we are in a git repo once
+  local git_root
+  git_root=$(git rev-parse --show-toplevel 2>/dev/null)
+  [[ -z "$git_root" ]] && return
+
+  local ref
+  ref=$(git branch --show-current 2>/dev/null || git rev-parse --short HEAD 2>/dev/null)
+
+  # Output the formatted string: git:(branch)
+  printf '\001\e[34m\002git:(\001\e[32m\002%s\001\e[34m\002)\001\e[0m\002 ' "$ref"
+}
+
+# ----- Middle section (host, path, git) -----
+get_middle_section() {
+  local git_root
+  git_root=$(git rev-parse --show-toplevel 2>/dev/null)
+
+  if [[ -n "$git_root" ]]; then
+    # Git path
+    printf '\001\e[35m\002%s\001\e[0m\002 \001\e[36m\002%s\001\e[0m\002' "${HOSTNAME%%.*}" "${git_root##*/}"
+  else
+    # Not Git path
+    printf '\001\e[35m\002%s\001\e[0m\002 \001\e[36m\002%s\001\e[0m\002' "${HOSTNAME%%.*}" "${PWD/#$HOME/\~}"
+  fi
+}
+
+# ----- Prompt -----
+# Line 1: ╭ host (magenta), path (cyan), git info (blue, visually purple), time (gray)
+# Line 2: ╰ username:# (red) or username:$ (yellow)
+if [ "$EUID" -eq 0 ]; then
+  __prompt_color='\[\e[31m\]'
+  __prompt_user='root:#'
+else
+  __prompt_color='\[\e[33m\]'
+  __prompt_user='\u:$'
+fi
+
+PS1="${__prompt_color}╭\[\e[0m\] \$(get_middle_section) \$(get_git_info)\[\e[38;5;242m\][\t]\[\e[0m\]
+${__prompt_color}╰\[\e[0m\] ${__prompt_color}${__prompt_user}\[\e[0m\] "
+
+# ----- Ensure blinking cursor -----
+echo -ne '\e[1 q'
@@ -0,0 +1,3 @@
+# ----- fzf -----
+source /usr/share/doc/fzf/examples/completion.bash
+source /usr/share/doc/fzf/examples/key-bindings.bash
@@ -0,0 +1,3 @@
+# ----- Aliases (macOS) -----
+alias ls='ls -AG'                     # List all entries except . and ..
+alias cat='bat'                       # Use bat for syntax highlighting if installed
@@ -0,0 +1,6 @@
+# =====================================
+# Config (macOS)
+# =====================================
+
+export LSCOLORS="Gxfxcxdxbxegedabagacad"
+export BASH_SILENCE_DEPRECATION_WARNING=1
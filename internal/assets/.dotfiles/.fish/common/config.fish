@@ -0,0 +1,19 @@
+# =====================================
+# Config (common)
+# =====================================
+
+set -gx TZ {{fishquote .timezone}}
+{{- if .editor}}
+set -gx EDITOR {{fishquote .editor}}
+set -gx VISUAL {{fishquote .editor}}
+{{- end}}
+{{- range paths .extra_path}}
+fish_add_path --append {{fishpath .}}
+{{- end}}
+
+if test "$TERM" = "xterm"
+    set -gx TERM "xterm-256color"
+end
+
+# ----- fish config -----
+set -g fish_greeting
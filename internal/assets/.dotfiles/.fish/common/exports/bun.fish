@@ -0,0 +1,3 @@
+# ----- Bun -----
+set -gx BUN_INSTALL "$HOME/.bun"
+fish_add_path "$BUN_INSTALL/bin"
@@ -0,0 +1,2 @@
+# ----- Golang -----
+fish_add_path --append $HOME/go/bin
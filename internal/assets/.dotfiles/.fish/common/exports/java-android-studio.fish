@@ -0,0 +1,5 @@
+# ----- Java & Android Studio -----
+set -gx JAVA_HOME /Library/Java/JavaVirtualMachines/zulu-17.jdk/Contents/Home
+set -gx ANDROID_HOME $HOME/Library/Android/sdk
+fish_add_path --append $ANDROID_HOME/emulator
+fish_add_path --append $ANDROID_HOME/platform-tools
@@ -0,0 +1,11 @@
+# ----- NVM -----
+# nvm has no fish support, so put the default node on the PATH.
+set -gx NVM_DIR "$HOME/.nvm"
+if test -n "$XDG_CONFIG_HOME"
+    set -gx NVM_DIR "$XDG_CONFIG_HOME/nvm"
+end
+if test -f "$NVM_DIR/alias/default"
+    set -l node_version (cat "$NVM_DIR/alias/default")
+    set -l node_bin (ls -d "$NVM_DIR"/versions/node/v$node_version*/bin 2>/dev/null)[-1]
+    test -n "$node_bin"; and fish_add_path "$node_bin"
+end
@@ -0,0 +1,2 @@
+# ----- PIPX -----
+fish_add_path "$HOME/.local/bin"
@@ -0,0 +1,12 @@
+set -gx FZF_DEFAULT_OPTS "
+  --layout=reverse
+  --height=80%
+  --border
+"
+
+set -gx FZF_CTRL_T_OPTS "--preview 'cat {}'"
+
+if command -q fd
+    set -gx FZF_DEFAULT_COMMAND 'fd --type f --strip-cwd-prefix --hidden --exclude .git'
+    set -gx FZF_CTRL_T_COMMAND "$FZF_DEFAULT_COMMAND"
+end
@@ -0,0 +1,43 @@
+# =====================================
+# Prompt (common)
+# =====================================
+
+# ----- Git info -----
+function __stash_git_info
+    set -l ref (git branch --show-current 2>/dev/null; or git rev-parse --short HEAD 2>/dev/null)
+    test -z "$ref"; and return
+
+    # Output the formatted string: git:(branch)
+    echo -n (set_color blue)"git:("(set_color green)$ref(set_color blue)")"(set_color normal)" "
+end
+
+# ----- Middle section (host, path, git) -----
+function __stash_middle_section
+    set -l git_root (git rev-parse --show-toplevel 2>/dev/null)
+
+    if test -n "$git_root"
+        # Git path
+        echo -n (set_color magenta)(prompt_hostname)(set_color normal)" "(set_color cyan)(basename $git_root)(set_color normal)
+    else
+        # Not Git path
+        echo -n (set_color magenta)(prompt_hostname)(set_color normal)" "(set_color cyan)(prompt_pwd --full-length-dirs 99)(set_color normal)
+    end
+end
+
+# ----- Prompt -----
+# Line 1: ╭ host (magenta), path (cyan), git info (blue, visually purple), time (gray)
+# Line 2: ╰ username:# (red) or username:$ (yellow)
+function fish_prompt
+    set -l color yellow
+    set -l user "$USER:\$"
+    if fish_is_root_user
+        set color red
+        set user "root:#"
+    end
+
+    echo (set_color $color)"╭"(set_color normal)" "(__stash_middle_section)" "(__stash_git_info)(set_color 888)"["(date +%H:%M:%S)"]"(set_color normal)
+    echo -n (set_color $color)"╰"(set_color normal)" "(set_color $color)$user(set_color normal)" "
+end
+
+# ----- Ensure blinking cursor -----
+echo -ne '\e[1 q'
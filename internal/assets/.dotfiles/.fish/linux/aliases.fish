@@ -0,0 +1,3 @@
+# ----- Aliases (Linux) -----
+alias ls='ls -A --color'              # List all entries except . and ..
+alias cat='batcat'                    # Use bat for syntax highlighting if installed
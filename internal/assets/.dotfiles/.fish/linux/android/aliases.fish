@@ -0,0 +1,2 @@
+# ----- Aliases (Linux:Android) -----
+alias notes='cd /mnt/shared/Documents/.notes/obsidian-notes'
@@ -0,0 +1,5 @@
+# =====================================
+# Config (Linux)
+# =====================================
+
+set -gx LS_COLORS "di=01;36:ln=01;35:so=01;32:pi=01;33:ex=01;31:bd=34;46:cd=34;43:su=30;41:sg=30;46:tw=30;42:ow=30;43"
@@ -0,0 +1,3 @@
+# ----- PNPM (Linux) -----
+set -gx PNPM_HOME "$HOME/.local/share/pnpm"
+fish_add_path "$PNPM_HOME"
@@ -0,0 +1,3 @@
+# ----- fzf -----
+source /usr/share/doc/fzf/examples/key-bindings.fish
+fzf_key_bindings
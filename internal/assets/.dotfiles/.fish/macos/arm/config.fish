@@ -0,0 +1,4 @@
+# ----- Homebrew -----
+if status is-login
+    /opt/homebrew/bin/brew shellenv | source
+end
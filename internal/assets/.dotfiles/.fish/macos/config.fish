@@ -0,0 +1,5 @@
+# =====================================
+# Config (macOS)
+# =====================================
+
+set -gx LSCOLORS "Gxfxcxdxbxegedabagacad"
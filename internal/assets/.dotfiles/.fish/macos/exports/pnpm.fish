@@ -0,0 +1,3 @@
+# ----- PNPM (macOS) -----
+set -gx PNPM_HOME "$HOME/Library/pnpm"
+fish_add_path "$PNPM_HOME"
@@ -0,0 +1,22 @@
+# ----- Aliases (macOS:amd64) -----
+# --- Map brew commands to macports ---
+function brew
+    switch $argv[1]
+        case search
+            port search $argv[2]
+        case update
+            sudo port selfupdate
+        case list
+            port installed
+        case outdated
+            port outdated
+        case upgrade
+            sudo port upgrade outdated
+        case cleanup
+            sudo port reclaim
+        case doctor
+            port diagnose
+        case '*'
+            echo "Usage: brew {search|update|list|outdated|upgrade|cleanup|doctor}"
+    end
+end
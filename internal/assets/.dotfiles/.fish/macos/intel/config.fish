@@ -0,0 +1,3 @@
+# ----- MacPorts -----
+fish_add_path /opt/local/bin /opt/local/sbin
+set -gx MANPATH /opt/local/share/man $MANPATH
@@ -0,0 +1,2 @@
+# ----- fzf -----
+fzf --fish | source
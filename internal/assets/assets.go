@@ -2,5 +2,7 @@ package assets
 
 import "embed"
 
-//go:embed all:.dotfiles/.zsh all:.dotfiles/git scripts
+//go:embed all:.dotfiles/.zsh all:.dotfiles/.bash all:.dotfiles/.fish all:.dotfiles/git all:.dotfiles/.vscode
+//go:embed .dotfiles/biome.json .dotfiles/.biomeignore .dotfiles/.prettierrc .dotfiles/.prettierignore
+//go:embed .dotfiles/.dockerignore .dotfiles/.pnpmfile.cjs scripts catalog.json
 var Files embed.FS
@@ -0,0 +1,188 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/huffmanks/stash/internal/assets"
+)
+
+// Method describes how a package is installed when it does not come from
+// the system package manager. Exactly one field is expected to be set.
+type Method struct {
+	Script  string `json:"script,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Shell   string `json:"shell,omitempty"`
+	Asset   string `json:"asset,omitempty"`
+	Clone   string `json:"clone,omitempty"`
+	Builtin string `json:"builtin,omitempty"`
+	Skip    string `json:"skip,omitempty"`
+}
+
+type Hook struct {
+	Command string   `json:"command"`
+	OS      []string `json:"os,omitempty"`
+}
+
+// Package is one catalog entry. Install is keyed by GOOS with "default" as
+// the fallback; when neither matches, the package manager is used with the
+// name from Names or the package name itself. Bins and Paths are used to
+// detect an existing install; Bins defaults to the package name.
+type Package struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"category,omitempty"`
+	Names     map[string]string `json:"names,omitempty"`
+	Install   map[string]Method `json:"install,omitempty"`
+	Hooks     []Hook            `json:"hooks,omitempty"`
+	Requires  []string          `json:"requires,omitempty"`
+	Fragments []string          `json:"fragments,omitempty"`
+	OS        []string          `json:"os,omitempty"`
+	Bins      []string          `json:"bins,omitempty"`
+	Paths     []string          `json:"paths,omitempty"`
+}
+
+type Catalog struct {
+	Categories []string  `json:"categories"`
+	Packages   []Package `json:"packages"`
+}
+
+var (
+	loadOnce sync.Once
+	loaded   *Catalog
+	loadErr  error
+)
+
+// UserPath is the optional catalog users can add to extend the embedded one
+// without rebuilding stash.
+func UserPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "stash", "catalog.json")
+}
+
+// Load returns the embedded catalog merged with the user catalog. Entries
+// in the user catalog replace embedded entries of the same name. When the
+// user catalog is invalid the embedded catalog is still returned alongside
+// the error.
+func Load() (*Catalog, error) {
+	loadOnce.Do(func() {
+		data, err := assets.Files.ReadFile("catalog.json")
+		if err != nil {
+			loadErr = fmt.Errorf("read embedded catalog: %w", err)
+			loaded = &Catalog{}
+			return
+		}
+
+		loaded = &Catalog{}
+		if err := json.Unmarshal(data, loaded); err != nil {
+			loadErr = fmt.Errorf("parse embedded catalog: %w", err)
+			return
+		}
+
+		userData, err := os.ReadFile(UserPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			loadErr = err
+			return
+		}
+
+		var user Catalog
+		if err := json.Unmarshal(userData, &user); err != nil {
+			loadErr = fmt.Errorf("parse %s: %w", UserPath(), err)
+			return
+		}
+
+		loaded.merge(&user)
+	})
+
+	return loaded, loadErr
+}
+
+func (c *Catalog) merge(other *Catalog) {
+	for _, cat := range other.Categories {
+		if !slices.Contains(c.Categories, cat) {
+			c.Categories = append(c.Categories, cat)
+		}
+	}
+
+	for _, p := range other.Packages {
+		i := slices.IndexFunc(c.Packages, func(e Package) bool { return e.Name == p.Name })
+		if i >= 0 {
+			c.Packages[i] = p
+		} else {
+			c.Packages = append(c.Packages, p)
+		}
+
+		if p.Category != "" && !slices.Contains(c.Categories, p.Category) {
+			c.Categories = append(c.Categories, p.Category)
+		}
+	}
+}
+
+func (c *Catalog) Get(name string) (Package, bool) {
+	i := slices.IndexFunc(c.Packages, func(p Package) bool { return p.Name == name })
+	if i < 0 {
+		return Package{}, false
+	}
+	return c.Packages[i], true
+}
+
+// InCategory returns the names of packages in cat that support goos,
+// sorted alphabetically.
+func (c *Catalog) InCategory(cat, goos string) []string {
+	var names []string
+	for _, p := range c.Packages {
+		if p.Category == cat && p.SupportsOS(goos) {
+			names = append(names, p.Name)
+		}
+	}
+
+	slices.Sort(names)
+	return names
+}
+
+func (p Package) SupportsOS(goos string) bool {
+	return len(p.OS) == 0 || slices.Contains(p.OS, goos)
+}
+
+// NameFor returns the name the package has in the given package manager.
+func (p Package) NameFor(pm string) string {
+	if name, ok := p.Names[pm]; ok {
+		return name
+	}
+	return p.Name
+}
+
+// MethodFor returns the custom install method for goos, if any.
+func (p Package) MethodFor(goos string) (Method, bool) {
+	if m, ok := p.Install[goos]; ok {
+		return m, true
+	}
+	m, ok := p.Install["default"]
+	return m, ok
+}
+
+func (p Package) HooksFor(goos string) []Hook {
+	var hooks []Hook
+	for _, h := range p.Hooks {
+		if len(h.OS) == 0 || slices.Contains(h.OS, goos) {
+			hooks = append(hooks, h)
+		}
+	}
+	return hooks
+}
+
+// ResolvePkgName returns the package manager specific name for pkg.
+func ResolvePkgName(pm, pkg string) string {
+	cat, _ := Load()
+	if p, ok := cat.Get(pkg); ok {
+		return p.NameFor(pm)
+	}
+	return pkg
+}
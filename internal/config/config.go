@@ -2,25 +2,167 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var Version = "dev_x.x.x"
 
 type Config struct {
-	App            string   `json:"app"`
-	Version        string   `json:"version"`
-	Operation      string   `json:"operation"`
-	PackageManager string   `json:"package_manager"`
-	BuildFiles     []string `json:"build_files"`
-	GitName        string   `json:"git_name"`
-	GitEmail       string   `json:"git_email"`
-	GitBranch      string   `json:"git_branch"`
-	GHPath         string   `json:"-"`
-	SelectedPkgs   []string `json:"selected_pkgs"`
-	Confirm        bool     `json:"-"`
-	StartOver      bool     `json:"-"`
+	App               string        `json:"app"`
+	Version           string        `json:"version"`
+	Operation         string        `json:"operation"`
+	PackageManager    string        `json:"package_manager"`
+	Shell             string        `json:"shell,omitempty"`
+	BuildFiles        []string      `json:"build_files"`
+	GitName           string        `json:"git_name"`
+	GitEmail          string        `json:"git_email"`
+	GitBranch         string        `json:"git_branch"`
+	GitSigning        string        `json:"git_signing,omitempty"`
+	GitSigningKey     string        `json:"git_signing_key,omitempty"`
+	GitExtras         []string      `json:"git_extras,omitempty"`
+	GitTool           string        `json:"git_tool,omitempty"`
+	GitIdentities     []GitIdentity `json:"git_identities,omitempty"`
+	GitMerge          bool          `json:"git_merge,omitempty"`
+	GitIgnore         []string      `json:"git_ignore"`
+	GitIgnorePatterns []string      `json:"git_ignore_patterns,omitempty"`
+	GHPath            string        `json:"-"`
+	SelectedPkgs      []string      `json:"selected_pkgs"`
+	Confirm           bool          `json:"-"`
+	StartOver         bool          `json:"-"`
+
+	Restore     string            `json:"restore,omitempty"`
+	RestoreAt   string            `json:"restore_at,omitempty"`
+	OnInstalled string            `json:"on_installed,omitempty"`
+	PkgActions  map[string]string `json:"pkg_actions,omitempty"`
+
+	Managed bool              `json:"managed,omitempty"`
+	Vars    map[string]string `json:"vars,omitempty"`
+	Sources []Source          `json:"sources,omitempty"`
+
+	Channel string `json:"channel,omitempty"`
+
+	KeepLast   int    `json:"keep_last,omitempty"`
+	KeepWithin string `json:"keep_within,omitempty"`
+	PerFile    bool   `json:"per_file,omitempty"`
+}
+
+// Source is a local directory or git repository with the same layout as
+// the embedded dotfiles, layered over them. Replace drops the layers below
+// it instead of layering over them.
+type Source struct {
+	Path    string `json:"path,omitempty"`
+	Git     string `json:"git,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+	Replace bool   `json:"replace,omitempty"`
+}
+
+// GitIdentity is a name and email used instead of the main ones for repos
+// under Dir or with a remote matching Remote, e.g. "git@github.com:acme/**".
+// It is written to ~/.config/git/<Name>.gitconfig and pulled in with
+// includeIf.
+type GitIdentity struct {
+	Name       string `json:"name"`
+	GitName    string `json:"git_name"`
+	GitEmail   string `json:"git_email"`
+	Dir        string `json:"dir,omitempty"`
+	Remote     string `json:"remote,omitempty"`
+	SigningKey string `json:"signing_key,omitempty"`
+}
+
+// IdentityFor returns the identity whose file is file, see IdentityFile.
+func (c *Config) IdentityFor(file string) (GitIdentity, bool) {
+	for _, id := range c.GitIdentities {
+		if IdentityFile(id.Name) == file {
+			return id, true
+		}
+	}
+	return GitIdentity{}, false
+}
+
+// Channels are the release channels stash updates from: stable releases
+// only, or prereleases too (goreleaser marks tags such as v1.2.0-rc.1 as
+// prereleases).
+var Channels = []string{"stable", "prerelease"}
+
+// UpdateChannel returns the channel stash updates from, stable unless
+// Channel says otherwise.
+func (c *Config) UpdateChannel() string {
+	if c.Channel == "" {
+		return "stable"
+	}
+	return c.Channel
+}
+
+var InstalledActions = []string{"skip", "reinstall", "upgrade"}
+
+// ActionFor returns what to do with pkg when it is already installed:
+// skip, reinstall or upgrade. Skipping is the default.
+func (c *Config) ActionFor(pkg string) string {
+	if action, ok := c.PkgActions[pkg]; ok {
+		return action
+	}
+	if c.OnInstalled != "" {
+		return c.OnInstalled
+	}
+	return "skip"
+}
+
+// HasGitExtra reports whether the optional .gitconfig section name is
+// enabled, see GitExtras.
+func (c *Config) HasGitExtra(name string) bool {
+	return slices.Contains(c.GitExtras, name)
+}
+
+// IgnoreFragments returns the .gitignore fragments to build from: the
+// ones in GitIgnore, or DefaultIgnoreFragments when it was never set, plus
+// the toolchain fragments of every selected package.
+func (c *Config) IgnoreFragments() []string {
+	names := c.GitIgnore
+	if names == nil {
+		names = DefaultIgnoreFragments
+	}
+
+	var out []string
+	for _, f := range GitIgnoreFragments {
+		tied := slices.ContainsFunc(f.Pkgs, func(p string) bool { return slices.Contains(c.SelectedPkgs, p) })
+		if tied || slices.Contains(names, f.Name) {
+			out = append(out, f.Name)
+		}
+	}
+	return out
+}
+
+// HasRetention reports whether delete should keep some backups instead of
+// removing all of them.
+func (c *Config) HasRetention() bool {
+	return c.KeepLast > 0 || c.KeepWithin != ""
+}
+
+// ParseAge parses a retention age. On top of time.ParseDuration it accepts
+// whole days and weeks, e.g. 30d or 2w.
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			if v, err := strconv.Atoi(n); err == nil && v >= 0 {
+				return time.Duration(v) * unit, nil
+			}
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q, use e.g. 30d, 2w or 12h", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("age must not be negative: %q", s)
+	}
+	return d, nil
 }
 
 func Load() (*Config, error) {
@@ -65,15 +207,105 @@ func (c *Config) Save() error {
 	return os.WriteFile(path, data, 0644)
 }
 
-type MacPortRelease struct {
-	TagName string `json:"tag_name"`
-	Assets  []struct {
-		Name               string `json:"name"`
-		BrowserDownloadURL string `json:"browser_download_url"`
-	} `json:"assets"`
-}
-
 type DeleteResult struct {
 	Deleted []string
 	Failed  []string
 }
+
+type PkgStatus struct {
+	Name      string `json:"name"`
+	Installed bool   `json:"installed"`
+	Version   string `json:"version,omitempty"`
+	Source    string `json:"source,omitempty"`
+}
+
+type Backup struct {
+	Path string    `json:"path"`
+	File string    `json:"file"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// BackupDecision records whether a retention policy keeps a backup and why.
+type BackupDecision struct {
+	Backup
+	Keep   bool   `json:"keep"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type FileStatus struct {
+	File     string `json:"file"`
+	Path     string `json:"path"`
+	State    string `json:"state"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+type StatusReport struct {
+	Packages     []PkgStatus  `json:"packages"`
+	Files        []FileStatus `json:"files"`
+	StaleBackups []Backup     `json:"stale_backups"`
+	Drift        bool         `json:"drift"`
+}
+
+type Result struct {
+	Operation string   `json:"operation"`
+	DryRun    bool     `json:"dry_run"`
+	Succeeded []string `json:"succeeded"`
+	Failed    []string `json:"failed"`
+	Skipped   []string `json:"skipped"`
+}
+
+func (r *Result) OK() bool {
+	return len(r.Failed) == 0
+}
+
+// VersionCheck is the last lookup of the latest release, cached so stash
+// does not hit the network on every run.
+type VersionCheck struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Channel   string    `json:"channel"`
+	Latest    string    `json:"latest,omitempty"`
+}
+
+// Record is what stash did to this machine, so uninstall can revert it:
+// the files it wrote, the plugin directories it cloned and the packages it
+// installed.
+type Record struct {
+	Files    []RecordedFile    `json:"files,omitempty"`
+	Clones   []RecordedClone   `json:"clones,omitempty"`
+	Packages []RecordedPackage `json:"packages,omitempty"`
+}
+
+// RecordedFile is a file stash wrote for the first time at Time. Backup is
+// the copy taken before that write, empty when the file did not exist.
+type RecordedFile struct {
+	File   string    `json:"file"`
+	Path   string    `json:"path"`
+	Backup string    `json:"backup,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+type RecordedClone struct {
+	Package string    `json:"package"`
+	Path    string    `json:"path"`
+	Time    time.Time `json:"time"`
+}
+
+// RecordedPackage is a package stash installed that was missing before.
+// Manager and Name are set when it came from the package manager, under
+// the name the manager knows it by; Kind is the step that installed it.
+type RecordedPackage struct {
+	Package string    `json:"package"`
+	Kind    StepKind  `json:"kind"`
+	Manager string    `json:"manager,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// SigningKey is a key found on the machine that commits can be signed
+// with: a public key file for ssh, or a key ID for gpg.
+type SigningKey struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
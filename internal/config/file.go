@@ -0,0 +1,355 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var Operations = []string{"configure", "install", "delete", "restore"}
+
+var PackageManagers = []string{"apt", "apk", "dnf", "homebrew", "macports", "nix", "pacman", "xbps", "zypper"}
+
+var BuildTargets = []string{".zshrc", ".zprofile", ".bashrc", ".bash_profile", ".config/fish/config.fish", ".gitconfig", ".gitignore", VSCodeSettings}
+
+// VSCodeSettings is the build target for the VS Code user settings. Unlike
+// the other targets it does not name a path under $HOME, since where VS Code
+// keeps its settings depends on the platform.
+const VSCodeSettings = "vscode/settings.json"
+
+// GitSigningFormats are the ways commits and tags can be signed.
+var GitSigningFormats = []string{"ssh", "gpg"}
+
+// GitExtras are the optional .gitconfig sections: pull.rebase,
+// push.autoSetupRemote, rerere and a curated alias set.
+var GitExtras = []string{"pull_rebase", "auto_setup_remote", "rerere", "aliases"}
+
+// GitTools are the diff and merge tools .gitconfig can be set up for.
+var GitTools = []string{"vscode", "vimdiff", "nvimdiff", "meld", "opendiff", "kdiff3"}
+
+// IgnoreFragment is a part of the global .gitignore, read from
+// git/ignore/<Name>.gitignore in the dotfiles. Fragments with Pkgs are
+// included whenever one of those packages is selected.
+type IgnoreFragment struct {
+	Name  string
+	Label string
+	Group string
+	Pkgs  []string
+}
+
+// GitIgnoreFragments are the .gitignore fragments in the order they are
+// written.
+var GitIgnoreFragments = []IgnoreFragment{
+	{Name: "macos", Label: "macOS", Group: "os"},
+	{Name: "linux", Label: "Linux", Group: "os"},
+	{Name: "windows", Label: "Windows", Group: "os"},
+	{Name: "vscode", Label: "VS Code", Group: "editor"},
+	{Name: "jetbrains", Label: "JetBrains", Group: "editor"},
+	{Name: "vim", Label: "Vim and swap files", Group: "editor"},
+	{Name: "node", Label: "Node", Group: "toolchain", Pkgs: []string{"nvm"}},
+	{Name: "bun", Label: "Bun", Group: "toolchain", Pkgs: []string{"bun"}},
+	{Name: "pnpm", Label: "pnpm", Group: "toolchain", Pkgs: []string{"pnpm"}},
+	{Name: "go", Label: "Go", Group: "toolchain", Pkgs: []string{"go"}},
+	{Name: "python", Label: "Python", Group: "toolchain", Pkgs: []string{"pipx"}},
+	{Name: "java", Label: "Java and Android", Group: "toolchain", Pkgs: []string{"java-android-studio"}},
+	{Name: "build", Label: "Build output", Group: "common"},
+	{Name: "env", Label: "Environment files", Group: "common"},
+	{Name: "logs", Label: "Logs", Group: "common"},
+	{Name: "coverage", Label: "Test coverage", Group: "common"},
+	{Name: "archives", Label: "Archives", Group: "common"},
+}
+
+// DefaultIgnoreFragments are used when git_ignore is not set. Together they
+// cover what the single embedded .gitignore used to.
+var DefaultIgnoreFragments = []string{"macos", "linux", "windows", "vim", "node", "python", "build", "env", "logs", "coverage", "archives"}
+
+// IdentityFile is where the git identity name is written, relative to
+// $HOME.
+func IdentityFile(name string) string {
+	return ".config/git/" + name + ".gitconfig"
+}
+
+var identityName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidIdentityName reports whether name can be used for a git identity,
+// whose file is named after it.
+func ValidIdentityName(name string) bool {
+	return identityName.MatchString(name)
+}
+
+// StashTarget reports whether file, relative to $HOME, is one stash builds:
+// a build target or a git identity file.
+func StashTarget(file string) bool {
+	if slices.Contains(BuildTargets, file) {
+		return true
+	}
+	rest, ok := strings.CutPrefix(file, ".config/git/")
+	if !ok {
+		return false
+	}
+	name, ok := strings.CutSuffix(rest, ".gitconfig")
+	return ok && ValidIdentityName(name)
+}
+
+var Shells = []string{"zsh", "bash", "fish"}
+
+// ShellRC is the rc file stash builds for each shell, relative to $HOME.
+var ShellRC = map[string]string{"zsh": ".zshrc", "bash": ".bashrc", "fish": ".config/fish/config.fish"}
+
+// ShellProfile is the login profile stash builds for each shell. fish reads
+// everything from config.fish so it has none.
+var ShellProfile = map[string]string{"zsh": ".zprofile", "bash": ".bash_profile"}
+
+// RCShell returns the shell file is the rc file of.
+func RCShell(file string) (string, bool) {
+	for shell, rc := range ShellRC {
+		if rc == file {
+			return shell, true
+		}
+	}
+	return "", false
+}
+
+// ProfileShell returns the shell file is the login profile of.
+func ProfileShell(file string) (string, bool) {
+	for shell, profile := range ShellProfile {
+		if profile == file {
+			return shell, true
+		}
+	}
+	return "", false
+}
+
+// ShellFiles returns the build targets that belong to shell.
+func ShellFiles(shell string) []string {
+	files := []string{ShellRC[shell]}
+	if profile, ok := ShellProfile[shell]; ok {
+		files = append(files, profile)
+	}
+	return files
+}
+
+// HasShellRC reports whether files include any shell rc file, the only
+// targets that depend on the selected packages.
+func HasShellRC(files []string) bool {
+	return slices.ContainsFunc(files, func(f string) bool {
+		_, ok := RCShell(f)
+		return ok
+	})
+}
+
+// LoadFile reads a config file for non-interactive runs. Files ending in
+// .yaml or .yml are decoded as YAML, everything else as JSON. YAML keys use
+// the same names as the saved config.json.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		var raw map[string]any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+
+		// Vars are strings, but YAML reads history_size: 5000 as a number
+		// and yes/true as a bool.
+		if vars, ok := raw["vars"].(map[string]any); ok {
+			for k, v := range vars {
+				switch v.(type) {
+				case int, int64, uint64, float64, bool:
+					vars[k] = fmt.Sprint(v)
+				}
+			}
+		}
+
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+
+	conf := &Config{
+		SelectedPkgs: []string{},
+		BuildFiles:   []string{},
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(conf); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	return conf, nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+
+	if !slices.Contains(Operations, c.Operation) {
+		errs = append(errs, fmt.Errorf("operation must be one of %s, got %q", strings.Join(Operations, ", "), c.Operation))
+	}
+
+	switch c.Operation {
+	case "install":
+		if !slices.Contains(PackageManagers, c.PackageManager) {
+			errs = append(errs, fmt.Errorf("package_manager must be one of %s, got %q", strings.Join(PackageManagers, ", "), c.PackageManager))
+		}
+
+		if len(c.SelectedPkgs) == 0 {
+			errs = append(errs, errors.New("selected_pkgs must not be empty for install"))
+		}
+
+	case "delete":
+		if c.KeepLast < 0 {
+			errs = append(errs, fmt.Errorf("keep_last must not be negative, got %d", c.KeepLast))
+		}
+
+		if c.KeepWithin != "" {
+			if _, err := ParseAge(c.KeepWithin); err != nil {
+				errs = append(errs, fmt.Errorf("keep_within: %w", err))
+			}
+		}
+
+	case "restore":
+		if strings.TrimSpace(c.Restore) == "" {
+			errs = append(errs, errors.New("restore must name the file to restore, e.g. .zshrc"))
+		}
+
+	case "configure":
+		if c.Shell != "" && !slices.Contains(Shells, c.Shell) {
+			errs = append(errs, fmt.Errorf("shell must be one of %s, got %q", strings.Join(Shells, ", "), c.Shell))
+		}
+
+		if len(c.BuildFiles) == 0 && slices.Contains(Shells, c.Shell) {
+			c.BuildFiles = ShellFiles(c.Shell)
+		}
+
+		if len(c.BuildFiles) == 0 {
+			errs = append(errs, errors.New("build_files must not be empty for configure"))
+		}
+
+		for _, f := range c.BuildFiles {
+			if !slices.Contains(BuildTargets, f) {
+				errs = append(errs, fmt.Errorf("build_files: unknown file %q", f))
+			}
+		}
+
+		if v, ok := c.Vars["history_size"]; ok {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				errs = append(errs, fmt.Errorf("vars.history_size must be a number, got %q", v))
+			}
+		}
+
+		if slices.Contains(c.BuildFiles, ".gitignore") {
+			for _, name := range c.GitIgnore {
+				if !slices.ContainsFunc(GitIgnoreFragments, func(f IgnoreFragment) bool { return f.Name == name }) {
+					errs = append(errs, fmt.Errorf("git_ignore: unknown fragment %q", name))
+				}
+			}
+
+			for i, p := range c.GitIgnorePatterns {
+				if strings.TrimSpace(p) == "" {
+					errs = append(errs, fmt.Errorf("git_ignore_patterns[%d] must not be empty", i))
+				}
+			}
+		}
+
+		if slices.Contains(c.BuildFiles, ".gitconfig") {
+			if strings.TrimSpace(c.GitName) == "" {
+				errs = append(errs, errors.New("git_name is required for .gitconfig"))
+			}
+
+			if !strings.Contains(c.GitEmail, "@") || !strings.Contains(c.GitEmail, ".") {
+				errs = append(errs, fmt.Errorf("git_email is invalid: %q", c.GitEmail))
+			}
+
+			if strings.TrimSpace(c.GitBranch) == "" {
+				c.GitBranch = "main"
+			}
+
+			if c.GitSigning != "" && !slices.Contains(GitSigningFormats, c.GitSigning) {
+				errs = append(errs, fmt.Errorf("git_signing must be one of %s, got %q", strings.Join(GitSigningFormats, ", "), c.GitSigning))
+			}
+
+			if c.GitSigning != "" && strings.TrimSpace(c.GitSigningKey) == "" {
+				errs = append(errs, errors.New("git_signing_key is required when git_signing is set"))
+			}
+
+			for _, extra := range c.GitExtras {
+				if !slices.Contains(GitExtras, extra) {
+					errs = append(errs, fmt.Errorf("git_extras must be among %s, got %q", strings.Join(GitExtras, ", "), extra))
+				}
+			}
+
+			if c.GitTool != "" && !slices.Contains(GitTools, c.GitTool) {
+				errs = append(errs, fmt.Errorf("git_tool must be one of %s, got %q", strings.Join(GitTools, ", "), c.GitTool))
+			}
+
+			seen := map[string]bool{}
+			for i, id := range c.GitIdentities {
+				switch {
+				case !ValidIdentityName(id.Name):
+					errs = append(errs, fmt.Errorf("git_identities[%d]: name must be letters, digits, - or _, got %q", i, id.Name))
+				case seen[id.Name]:
+					errs = append(errs, fmt.Errorf("git_identities[%d]: duplicate name %q", i, id.Name))
+				}
+				seen[id.Name] = true
+
+				if strings.TrimSpace(id.GitName) == "" {
+					errs = append(errs, fmt.Errorf("git_identities[%d]: git_name is required", i))
+				}
+
+				if !strings.Contains(id.GitEmail, "@") || !strings.Contains(id.GitEmail, ".") {
+					errs = append(errs, fmt.Errorf("git_identities[%d]: git_email is invalid: %q", i, id.GitEmail))
+				}
+
+				if id.Dir == "" && id.Remote == "" {
+					errs = append(errs, fmt.Errorf("git_identities[%d]: set dir, remote or both", i))
+				}
+			}
+		}
+	}
+
+	if c.Channel != "" && !slices.Contains(Channels, c.Channel) {
+		errs = append(errs, fmt.Errorf("channel must be one of %s, got %q", strings.Join(Channels, ", "), c.Channel))
+	}
+
+	if c.OnInstalled != "" && !slices.Contains(InstalledActions, c.OnInstalled) {
+		errs = append(errs, fmt.Errorf("on_installed must be one of %s, got %q", strings.Join(InstalledActions, ", "), c.OnInstalled))
+	}
+
+	for pkg, action := range c.PkgActions {
+		if !slices.Contains(InstalledActions, action) {
+			errs = append(errs, fmt.Errorf("pkg_actions[%s] must be one of %s, got %q", pkg, strings.Join(InstalledActions, ", "), action))
+		}
+	}
+
+	for i, s := range c.Sources {
+		switch {
+		case (s.Path == "") == (s.Git == ""):
+			errs = append(errs, fmt.Errorf("sources[%d] must set exactly one of path or git", i))
+		case s.Ref != "" && s.Git == "":
+			errs = append(errs, fmt.Errorf("sources[%d]: ref is only valid with git", i))
+		}
+	}
+
+	for _, p := range c.SelectedPkgs {
+		if strings.TrimSpace(p) == "" {
+			errs = append(errs, errors.New("selected_pkgs must not contain empty names"))
+			break
+		}
+	}
+
+	return errors.Join(errs...)
+}
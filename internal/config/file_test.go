@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFileYAMLVars(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stash.yaml")
+	data := `operation: configure
+shell: zsh
+build_files: [.zshrc]
+managed: true
+vars:
+  history_size: 5000
+  ratio: 1.5
+  enabled: true
+  editor: nvim
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	want := map[string]string{"history_size": "5000", "ratio": "1.5", "enabled": "true", "editor": "nvim"}
+	for k, v := range want {
+		if c.Vars[k] != v {
+			t.Errorf("vars.%s = %q, want %q", k, c.Vars[k], v)
+		}
+	}
+	if !c.Managed {
+		t.Error("managed: true was not decoded")
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestLoadFileYAMLUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stash.yml")
+	if err := os.WriteFile(path, []byte("operation: configure\nshel: zsh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFile(path); err == nil {
+		t.Error("LoadFile with a misspelled key: want an error")
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import "encoding/json"
+
+type StepKind string
+
+const (
+	StepInstall StepKind = "install"
+	StepScript  StepKind = "script"
+	StepClone   StepKind = "clone"
+	StepHook    StepKind = "hook"
+	StepSkip    StepKind = "skip"
+	StepBackup  StepKind = "backup"
+	StepWrite   StepKind = "write"
+	StepDelete  StepKind = "delete"
+	StepKeep    StepKind = "keep"
+	StepRestore StepKind = "restore"
+)
+
+// Step is a single action in a Plan. Which fields are set depends on Kind:
+// install/script/hook steps carry a Command, clone steps a Source URL and
+// target Path, backup steps the file Path and its backup destination in
+// Source, write steps the target Path plus a sha256 Hash of Content,
+// restore steps the target Path plus the backup to copy from in Source, and
+// delete/keep steps the backup Path with the retention Reason. Write steps
+// that merge into a JSON file also list the keys they change and the keys
+// stash owns afterwards.
+type Step struct {
+	Kind     StepKind   `json:"kind"`
+	Package  string     `json:"package,omitempty"`
+	Manager  string     `json:"manager,omitempty"`
+	Action   string     `json:"action,omitempty"`
+	File     string     `json:"file,omitempty"`
+	Path     string     `json:"path,omitempty"`
+	Source   string     `json:"source,omitempty"`
+	Asset    string     `json:"asset,omitempty"`
+	Command  string     `json:"command,omitempty"`
+	Hash     string     `json:"hash,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+	Optional bool       `json:"optional,omitempty"`
+	Includes []string   `json:"includes,omitempty"`
+	Changes  []string   `json:"changes,omitempty"`
+	Owned    []OwnedKey `json:"owned,omitempty"`
+	Content  []byte     `json:"-"`
+}
+
+// OwnedKey is a key stash added to a JSON file, as the path of keys from
+// the top level, with the value it wrote. Stash removes it again once it no
+// longer sets it, unless the value was changed by hand.
+type OwnedKey struct {
+	Key   []string        `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type Plan struct {
+	Operation string  `json:"operation"`
+	OS        string  `json:"os"`
+	Arch      string  `json:"arch"`
+	Config    *Config `json:"config"`
+	Steps     []Step  `json:"steps"`
+}
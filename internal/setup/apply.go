@@ -0,0 +1,137 @@
+package setup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+type applySummary struct {
+	*config.Result
+	Config string `json:"config"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HandleApply runs the setup described by a config file, or a plan saved
+// with `stash plan --json`, without any prompts. Progress goes to stderr and
+// a JSON summary to stdout. The exit code is 0 on success, 1 when any step
+// failed and 2 when the input could not be loaded, is invalid or is stale.
+func HandleApply(configPath, planPath string, dryRun bool) {
+	utils.Interactive = false
+	tap.SetTermIO(nil, utils.StderrWriter{})
+
+	summary := applySummary{
+		Result: &config.Result{DryRun: dryRun, Succeeded: []string{}, Failed: []string{}, Skipped: []string{}},
+		Config: configPath,
+	}
+
+	var plan *config.Plan
+	var err error
+
+	switch {
+	case planPath != "":
+		summary.Config = planPath
+
+		if plan, err = LoadPlan(planPath); err == nil {
+			err = VerifyPlan(plan, runtime.GOOS, runtime.GOARCH)
+		}
+	case configPath != "":
+		plan, err = planFromFile(configPath)
+	default:
+		err = errors.New("missing --config <file> or --plan <file>")
+	}
+
+	if plan != nil {
+		summary.Operation = plan.Operation
+	}
+
+	if err != nil {
+		summary.Error = err.Error()
+		exitApply(summary, 2)
+	}
+
+	tap.Intro(fmt.Sprintf("stash apply: %s [%s]", plan.Operation, summary.Config))
+	RenderPlan(plan, false)
+
+	res, err := Execute(plan, dryRun)
+	if err != nil {
+		summary.Error = err.Error()
+		exitApply(summary, 1)
+	}
+
+	summary.Result = res
+
+	if !res.OK() {
+		tap.Outro(utils.Style(fmt.Sprintf("❌ [FAILED]: %d of %d", len(res.Failed), len(res.Failed)+len(res.Succeeded)), "red"))
+		exitApply(summary, 1)
+	}
+
+	tap.Outro(fmt.Sprintf("✅ [APPLIED]: %d succeeded, %d skipped", len(res.Succeeded), len(res.Skipped)))
+	exitApply(summary, 0)
+}
+
+// HandlePlan prints the plan for a config file, or for the saved config
+// when no file is given, as a table or as JSON that `stash apply --plan`
+// accepts.
+func HandlePlan(configPath string, asJSON bool) {
+	var plan *config.Plan
+	var err error
+
+	if configPath != "" {
+		plan, err = planFromFile(configPath)
+	} else {
+		var conf *config.Config
+		if conf, err = config.Load(); err == nil {
+			if err = conf.Validate(); err == nil {
+				plan, err = BuildPlan(conf, runtime.GOOS, runtime.GOARCH)
+			}
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stash plan: %v\n", err)
+		os.Exit(2)
+	}
+
+	if !asJSON {
+		tap.Intro(fmt.Sprintf("Plan: %s [%s/%s]", utils.Style(plan.Operation, "bold", "cyan"), plan.OS, plan.Arch))
+	}
+
+	if err := RenderPlan(plan, asJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "stash plan: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !asJSON {
+		tap.Outro(fmt.Sprintf("%d steps", len(plan.Steps)))
+	}
+
+	os.Exit(0)
+}
+
+func planFromFile(configPath string) (*config.Plan, error) {
+	conf, err := config.LoadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return BuildPlan(conf, runtime.GOOS, runtime.GOARCH)
+}
+
+func exitApply(summary applySummary, code int) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(summary)
+
+	os.Exit(code)
+}
@@ -0,0 +1,160 @@
+package setup
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// HandleBackups implements `stash backups list`,
+// `stash backups restore <file> [--at <timestamp>]` and
+// `stash backups prune [--keep-last N] [--keep-within age] [--per-file]`.
+func HandleBackups(banner string, args []string, dryRun bool) {
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+
+	switch sub {
+	case "list", "":
+		listCmd := flag.NewFlagSet("backups list", flag.ExitOnError)
+		asJSON := listCmd.Bool("json", false, "Print backups as JSON")
+		listCmd.Parse(argsAfter(args, 1))
+
+		listBackups(banner, *asJSON)
+
+	case "restore":
+		restoreCmd := flag.NewFlagSet("backups restore", flag.ExitOnError)
+		at := restoreCmd.String("at", "", "Timestamp of the backup to restore, as shown by `stash backups list` (default: latest)")
+		restoreDryRun := restoreCmd.Bool("dry-run", dryRun, "Run without making changes")
+		restoreCmd.BoolVar(restoreDryRun, "d", dryRun, "Run without making changes (shorthand)")
+
+		// Accept the file before or after the flags.
+		rest := argsAfter(args, 1)
+		file := ""
+		if len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+			file, rest = rest[0], rest[1:]
+		}
+		restoreCmd.Parse(rest)
+		if file == "" {
+			file = restoreCmd.Arg(0)
+		}
+
+		if file == "" {
+			fmt.Fprintln(os.Stderr, "Usage: stash backups restore <file> [--at <timestamp>]")
+			os.Exit(2)
+		}
+
+		restoreFile(banner, file, *at, *restoreDryRun)
+
+	case "prune":
+		pruneCmd := flag.NewFlagSet("backups prune", flag.ExitOnError)
+		keepLast := pruneCmd.Int("keep-last", 0, "Keep the newest N backups")
+		keepWithin := pruneCmd.String("keep-within", "", "Keep backups newer than this age, e.g. 30d, 2w or 12h")
+		perFile := pruneCmd.Bool("per-file", false, "Apply --keep-last to each file separately")
+		pruneDryRun := pruneCmd.Bool("dry-run", dryRun, "List what would be kept and removed without deleting")
+		pruneCmd.BoolVar(pruneDryRun, "d", dryRun, "List what would be kept and removed without deleting (shorthand)")
+
+		pruneCmd.Parse(argsAfter(args, 1))
+
+		conf := &config.Config{
+			Operation:  "delete",
+			KeepLast:   *keepLast,
+			KeepWithin: *keepWithin,
+			PerFile:    *perFile,
+		}
+
+		if err := conf.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "stash backups prune: %v\n", err)
+			os.Exit(2)
+		}
+
+		tap.Intro(banner)
+
+		if err := ExecuteSetup(conf, *pruneDryRun); err != nil {
+			tap.Outro(utils.Style(fmt.Sprintf("❌ [ERROR]: %v", err), "red"))
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown backups command: %s\nUsage: stash backups [list|restore|prune]\n", sub)
+		os.Exit(2)
+	}
+}
+
+func listBackups(banner string, asJSON bool) {
+	backups, err := utils.ListBackups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stash backups: %v\n", err)
+		os.Exit(1)
+	}
+
+	files, groups := utils.GroupBackups(backups)
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(groups)
+		os.Exit(0)
+	}
+
+	tap.Intro(banner)
+
+	if len(backups) == 0 {
+		tap.Outro("✨ [EMPTY]: No backups found.")
+		os.Exit(0)
+	}
+
+	for _, file := range files {
+		name := file
+		if name == "" {
+			name = "(unrecognized)"
+		}
+
+		rows := make([][]string, 0, len(groups[file]))
+		for _, b := range groups[file] {
+			rows = append(rows, []string{
+				utils.FormatBackupTime(b.Time),
+				b.Time.Format("2006-01-02 15:04:05"),
+				utils.FormatSize(b.Size),
+			})
+		}
+
+		tap.Message(utils.Style(fmt.Sprintf("%s (%d)", name, len(rows)), "bold", "cyan"))
+		tap.Table([]string{"--at", "Taken", "Size"}, rows, tap.TableOptions{
+			ShowBorders:   true,
+			IncludePrefix: true,
+			HeaderStyle:   tap.TableStyleBold,
+			HeaderColor:   tap.TableColorGreen,
+		})
+	}
+
+	tap.Outro(fmt.Sprintf("🗄️  [BACKUPS]: %d across %d files", len(backups), len(files)))
+	time.Sleep(time.Millisecond * 100)
+	os.Exit(0)
+}
+
+func restoreFile(banner, file, at string, dryRun bool) {
+	tap.Intro(banner)
+
+	conf := &config.Config{Operation: "restore", Restore: file, RestoreAt: at}
+
+	if err := ExecuteSetup(conf, dryRun); err != nil {
+		tap.Outro(utils.Style(fmt.Sprintf("❌ [ERROR]: %v", err), "red"))
+		os.Exit(1)
+	}
+}
+
+func argsAfter(args []string, n int) []string {
+	if len(args) <= n {
+		return nil
+	}
+	return args[n:]
+}
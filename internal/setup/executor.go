@@ -1,17 +1,14 @@
 package setup
 
 import (
-	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
-	"text/template"
 	"time"
 
-	"github.com/huffmanks/stash/internal/assets"
 	"github.com/huffmanks/stash/internal/config"
 	"github.com/huffmanks/stash/internal/utils"
 	"github.com/yarlson/tap"
@@ -24,157 +21,46 @@ func ExecuteSetup(c *config.Config, dryRun bool) error {
 		return nil
 	}
 
-	if c.Operation == "configure" && (len(c.BuildFiles) == 0 || (len(c.SelectedPkgs) == 0 && !slices.ContainsFunc(c.BuildFiles, func(f string) bool { return f != ".zshrc" }))) {
+	onlyRC := !slices.ContainsFunc(c.BuildFiles, func(f string) bool {
+		_, rc := config.RCShell(f)
+		return !rc
+	})
+
+	if c.Operation == "configure" && (len(c.BuildFiles) == 0 || (len(c.SelectedPkgs) == 0 && onlyRC)) {
 		tap.Outro(utils.Style("💡 [INFO]:  No shell files or packages selected to configure. Exiting.", "orange"))
 		return nil
 	}
 
-	pkgCount := 0
-	extraPkgs := 0
-	needsSystemTools := false
-
-	if c.Operation == "install" && len(c.SelectedPkgs) > 0 {
-
-		if !dryRun {
-			utils.PromptForSudo("❌ [ERROR]: sudo authentication failed.", "true", true)
-		}
-
-		if runtime.GOOS == "darwin" {
-			if !utils.CommandExists("xcode-select") {
-				extraPkgs++
-				needsSystemTools = true
-			}
-
-			if c.PackageManager == "brew" && !utils.CommandExists("brew") {
-				extraPkgs++
-				needsSystemTools = true
-			} else if c.PackageManager == "macports" && !utils.CommandExists("port") {
-				extraPkgs++
-				needsSystemTools = true
-			}
-		}
-
-		if runtime.GOOS == "linux" {
-			plugins := []string{"zsh-syntax-highlighting", "zsh-autosuggestions"}
-			hasPlugin := false
-
-			for _, p := range plugins {
-				if slices.Contains(c.SelectedPkgs, p) {
-					hasPlugin = true
-					break
-				}
-			}
-
-			if hasPlugin && !slices.Contains(c.SelectedPkgs, "zsh") {
-				c.SelectedPkgs = append(c.SelectedPkgs, "zsh")
-				extraPkgs++
-			}
-		}
-
-		pkgCount = len(c.SelectedPkgs) + extraPkgs
-
-		progress := tap.NewProgress(tap.ProgressOptions{
-			Max:   pkgCount,
-			Style: "heavy",
-			Size:  40,
-		})
-
-		progress.Start("Installing packages...")
-		time.Sleep(time.Millisecond * 100)
-
-		var failedPkgs []string
-
-		if needsSystemTools {
-			ensureMacOSPrereqs(c.PackageManager, dryRun, progress, &failedPkgs)
-		}
-
-		if err := installSystemPkgs(c, dryRun, progress, &failedPkgs); err != nil {
-			return err
-		}
-
-		time.Sleep(time.Millisecond * 100)
-		progress.Stop("🏁 [FINISHED]", 0)
-		time.Sleep(time.Millisecond * 100)
-
-		successfulPkgs := c.SelectedPkgs
-
-		if len(failedPkgs) > 0 {
-			failedMap := make(map[string]bool)
-			for _, p := range failedPkgs {
-				failedMap[p] = true
-			}
-
-			successfulPkgs = []string{}
-			for _, p := range c.SelectedPkgs {
-				if !failedMap[p] {
-					successfulPkgs = append(successfulPkgs, p)
-				}
-			}
-		}
+	res, err := Run(c, dryRun)
+	if err != nil {
+		return err
+	}
 
+	switch c.Operation {
+	case "install":
 		installedPkgsMsg := fmt.Sprintf("📦 [INSTALLED]: %d packages\n\n   %s",
-			len(successfulPkgs),
-			strings.Join(successfulPkgs, ", "))
+			len(res.Succeeded),
+			strings.Join(res.Succeeded, ", "))
 
-		if len(failedPkgs) > 0 {
+		if len(res.Failed) > 0 {
 
-			if len(successfulPkgs) > 0 {
+			if len(res.Succeeded) > 0 {
 				tap.Message(installedPkgsMsg)
 			}
 
 			failedPkgsMsg := fmt.Sprintf("❌ [FAILED]: %d packages\n\n   %s",
-				len(failedPkgs),
-				strings.Join(failedPkgs, ", "))
+				len(res.Failed),
+				strings.Join(res.Failed, ", "))
 
 			tap.Outro(failedPkgsMsg)
 		} else {
 			tap.Outro(installedPkgsMsg)
 		}
 
-		time.Sleep(time.Millisecond * 100)
-
-		os.Exit(0)
-	}
-
-	if c.Operation == "configure" && len(c.BuildFiles) > 0 {
-		var created []string
-		zshProcessed := false
-
-		if slices.Contains(c.BuildFiles, ".zshrc") {
-			zshProcessed = true
-		}
-
-		if slices.Contains(c.BuildFiles, ".zprofile") {
-			zshProcessed = true
-		}
-
-		if zshProcessed {
-			buildZshConfigs(c, runtime.GOOS, runtime.GOARCH, dryRun, &created)
-		}
-
-		if slices.Contains(c.BuildFiles, ".gitignore") {
-			gitignoreSpinner := tap.NewSpinner(tap.SpinnerOptions{
-				Delay: time.Millisecond * 100,
-			})
-
-			gitignoreSpinner.Start("Creating .gitignore...")
-			time.Sleep(time.Millisecond * 100)
-
-			copyGitIgnore(dryRun, &created, gitignoreSpinner)
-		}
-
-		if slices.Contains(c.BuildFiles, ".gitconfig") {
-			gitconfigSpinner := tap.NewSpinner(tap.SpinnerOptions{
-				Delay: time.Millisecond * 100,
-			})
+	case "configure":
+		success := res.Succeeded
+		missed := append(res.Failed, res.Skipped...)
 
-			gitconfigSpinner.Start("Creating .gitconfig...")
-			time.Sleep(time.Millisecond * 100)
-
-			createGitConfig(c, dryRun, &created, gitconfigSpinner)
-		}
-
-		success, missed := utils.Diff(c.BuildFiles, created)
 		confMsg := fmt.Sprintf("⚙️  [CONFIGURED]: %d packages\n   🗂️  [FILES]: %d created, %d skipped",
 			len(c.SelectedPkgs),
 			len(success),
@@ -183,17 +69,14 @@ func ExecuteSetup(c *config.Config, dryRun bool) error {
 		tap.Message(confMsg)
 
 		var sections []string
-		prefix := ""
-		if dryRun {
-			prefix = "test_"
-		}
 
 		if len(success) > 0 {
-			for i, f := range success {
-				success[i] = prefix + f
-			}
 			msg := fmt.Sprintf("The following files were created in your home directory:\n   %s",
 				utils.Style(strings.Join(success, ", "), "cyan"))
+			if dryRun {
+				msg = fmt.Sprintf(utils.Style("___ [DRY_RUN]: The following files would change: ___", "orange")+"\n   %s",
+					utils.Style(strings.Join(success, ", "), "cyan"))
+			}
 			sections = append(sections, msg)
 		}
 
@@ -208,146 +91,369 @@ func ExecuteSetup(c *config.Config, dryRun bool) error {
 			outroMsg = "✨ No files were processed."
 		}
 		tap.Outro(outroMsg)
-		time.Sleep(time.Millisecond * 100)
-
-		os.Exit(0)
-	}
-
-	if c.Operation == "delete" {
-		spinner := tap.NewSpinner(tap.SpinnerOptions{
-			Delay: time.Millisecond * 100,
-		})
-
-		spinner.Start("Scanning for backups...")
-		time.Sleep(time.Millisecond * 100)
-
-		report := utils.DeleteFiles(dryRun, spinner)
-
-		spinner.Stop("Cleanup process finished", 0)
-		time.Sleep(time.Millisecond * 100)
 
+	case "delete":
 		var outroMsg string
 
-		if len(report.Failed) > 0 {
-			outroMsg += fmt.Sprintf(utils.Style("❌ [FAILED]: %d\n\n", "red"), len(report.Failed))
+		if len(res.Failed) > 0 {
+			outroMsg += fmt.Sprintf(utils.Style("❌ [FAILED]: %d\n\n", "red"), len(res.Failed))
 
-			for _, f := range report.Failed {
+			for _, f := range res.Failed {
 				outroMsg += fmt.Sprintf(utils.Style("     - %s\n", "cyan"), f)
 			}
 			outroMsg += "\n"
 		}
 
-		if len(report.Deleted) > 0 {
-			header := fmt.Sprintf("🗑️  [DELETED]: %d\n\n", len(report.Deleted))
+		if len(res.Succeeded) > 0 {
+			header := fmt.Sprintf("🗑️  [DELETED]: %d\n\n", len(res.Succeeded))
 			if dryRun {
-				header = fmt.Sprintf("___ [DRY_RUN]: Would delete: %d ___\n\n", len(report.Deleted))
+				header = fmt.Sprintf("___ [DRY_RUN]: Would delete: %d ___\n\n", len(res.Succeeded))
 			}
 			outroMsg += fmt.Sprintf(utils.Style("%s", "orange"), header)
 
-			for _, f := range report.Deleted {
+			for _, f := range res.Succeeded {
 				outroMsg += fmt.Sprintf(utils.Style("     - %s\n", "cyan"), f)
 			}
 
 		}
 
-		if len(report.Failed) == 0 && len(report.Deleted) == 0 {
+		if len(res.Skipped) > 0 {
+			header := fmt.Sprintf("📌 [KEPT]: %d\n\n", len(res.Skipped))
+			if dryRun {
+				header = fmt.Sprintf("___ [DRY_RUN]: Would keep: %d ___\n\n", len(res.Skipped))
+			}
+			outroMsg += "\n" + fmt.Sprintf(utils.Style("%s", "green"), header)
+
+			for _, f := range res.Skipped {
+				outroMsg += fmt.Sprintf(utils.Style("     - %s\n", "cyan"), f)
+			}
+		}
+
+		if len(res.Failed) == 0 && len(res.Succeeded) == 0 && len(res.Skipped) == 0 {
 			outroMsg = "✨ [EMPTY]: No files found to delete."
 		}
 
 		tap.Outro(strings.TrimSpace(outroMsg))
-		time.Sleep(time.Millisecond * 100)
-
-		os.Exit(0)
 
+	case "restore":
+		if len(res.Failed) > 0 {
+			tap.Outro(utils.Style(fmt.Sprintf("❌ [FAILED]: restoring %s", c.Restore), "red"))
+		} else if dryRun {
+			tap.Outro(utils.Style(fmt.Sprintf("___ [DRY_RUN]: Would restore %s ___", c.Restore), "orange"))
+		} else {
+			tap.Outro(fmt.Sprintf("⏪ [RESTORED]: %s", c.Restore))
+		}
 	}
 
+	time.Sleep(time.Millisecond * 100)
+
+	os.Exit(0)
 	return nil
 }
 
-const gitConfigTmpl = `[init]
-    defaultBranch = {{.GitBranch}}
-
-[user]
-    name = {{.GitName}}
-    email = {{.GitEmail}}
-
-[core]
-    excludesfile = ~/.gitignore
-
-[http]
-    postBuffer = 10485760
-{{if .GHPath}}
-[credential "https://github.com"]
-    helper =
-    helper = !{{.GHPath}} auth git-credential
-[credential "https://gist.github.com"]
-    helper =
-    helper = !{{.GHPath}} auth git-credential
-{{end}}`
-
-func createGitConfig(c *config.Config, dryRun bool, created *[]string, spinner *tap.Spinner) {
-	spinner.Message(("🔨 [BUILDING]: .gitconfig from template..."))
-	time.Sleep(time.Millisecond * 100)
+// Run plans the operation described by c and executes the plan.
+func Run(c *config.Config, dryRun bool) (*config.Result, error) {
+	plan, err := BuildPlan(c, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, err
+	}
 
-	ghPath, err := exec.LookPath("gh")
-	if err == nil {
-		c.GHPath = ghPath
-	} else {
-		c.GHPath = ""
+	return Execute(plan, dryRun)
+}
+
+// Execute carries out every step of plan and reports what happened without
+// printing an outro or exiting, so both the interactive flow and
+// `stash apply` can share it.
+func Execute(plan *config.Plan, dryRun bool) (*config.Result, error) {
+	res := &config.Result{
+		Operation: plan.Operation,
+		DryRun:    dryRun,
+		Succeeded: []string{},
+		Failed:    []string{},
+		Skipped:   []string{},
 	}
 
-	tmpl, err := template.New("gitconfig").Parse(gitConfigTmpl)
-	if err != nil {
-		spinner.Stop("❌ [FAILED]: creating .gitconfig", 1)
-		time.Sleep(time.Millisecond * 100)
-		return
+	switch plan.Operation {
+	case "install":
+		executeInstall(plan.Steps, dryRun, res)
+	case "configure", "restore":
+		executeConfigure(plan.Steps, dryRun, res)
+	case "delete":
+		executeDelete(plan.Steps, dryRun, res)
+	default:
+		return nil, fmt.Errorf("unknown operation: %q", plan.Operation)
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, c); err != nil {
-		spinner.Stop("❌ [FAILED]: creating .gitconfig", 1)
-		time.Sleep(time.Millisecond * 100)
-		return
+	return res, nil
+}
+
+// groupSteps splits steps into runs that share the same key, keeping order.
+func groupSteps(steps []config.Step, key func(config.Step) string) [][]config.Step {
+	var groups [][]config.Step
+
+	for _, s := range steps {
+		if n := len(groups); n > 0 && key(groups[n-1][0]) == key(s) {
+			groups[n-1] = append(groups[n-1], s)
+			continue
+		}
+		groups = append(groups, []config.Step{s})
 	}
 
-	time.Sleep(time.Millisecond * 500)
+	return groups
+}
 
-	err = utils.WriteFiles(".gitconfig", buf.Bytes(), dryRun, spinner)
-	if err != nil {
-		spinner.Stop("❌ [FAILED]: writing .gitconfig", 1)
-		time.Sleep(time.Millisecond * 100)
+func executeInstall(steps []config.Step, dryRun bool, res *config.Result) {
+	groups := groupSteps(steps, func(s config.Step) string { return s.Package })
+	if len(groups) == 0 {
 		return
 	}
 
-	*created = append(*created, ".gitconfig")
-	spinner.Stop("✅ [CREATED]: .gitconfig", 0)
+	if !dryRun {
+		utils.PromptForSudo("❌ [ERROR]: sudo authentication failed.", "true", true)
+	}
+
+	progress := tap.NewProgress(tap.ProgressOptions{
+		Max:   len(groups),
+		Style: "heavy",
+		Size:  40,
+	})
+
+	progress.Start("Installing packages...")
 	time.Sleep(time.Millisecond * 100)
-}
 
-func copyGitIgnore(dryRun bool, created *[]string, spinner *tap.Spinner) {
-	spinner.Message(("🔍 [SEARCHING]: Looking for .gitignore..."))
+	for _, group := range groups {
+		pkg := group[0].Package
+
+		if group[0].Kind == config.StepSkip {
+			res.Skipped = append(res.Skipped, pkg)
+			progress.Advance(1, fmt.Sprintf("⚠️ [%s]: skipped, %s", pkg, group[0].Reason))
+			time.Sleep(time.Millisecond * 500)
+			continue
+		}
+
+		if runtime.GOOS != "linux" {
+			msg := fmt.Sprintf("📦 Installing %s...", pkg)
+			progress.Message(msg)
+			time.Sleep(time.Millisecond * 100)
+
+			if dryRun {
+				time.Sleep(time.Millisecond * 500)
+			}
+		}
+
+		// Only a package that was missing is recorded as stash's to remove
+		// again; gitClone leaves an existing directory alone.
+		fresh := group[0].Action == ""
+		if group[0].Kind == config.StepClone {
+			if _, err := os.Stat(group[0].Path); err == nil {
+				fresh = false
+			}
+		}
+
+		var err error
+		for _, s := range group {
+			stepErr := runInstallStep(s, dryRun, progress)
+			if stepErr != nil && !s.Optional {
+				err = stepErr
+				break
+			}
+		}
+
+		if err != nil {
+			res.Failed = append(res.Failed, pkg)
+			progress.Advance(1, fmt.Sprintf("❌ [%s]: failed", pkg))
+		} else {
+			res.Succeeded = append(res.Succeeded, pkg)
+			progress.Advance(1, fmt.Sprintf("✅ [%s]: installed", pkg))
+
+			if fresh && !dryRun {
+				if err := recordInstall(group[0]); err != nil {
+					progress.Message(utils.Style(fmt.Sprintf("⚠️  [WARNING]: recording %s - %v", pkg, err), "orange"))
+				}
+			}
+		}
+
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	progress.Stop("🏁 [FINISHED]", 0)
 	time.Sleep(time.Millisecond * 100)
+}
 
-	sourcePath := ".dotfiles/git/.gitignore"
+func executeConfigure(steps []config.Step, dryRun bool, res *config.Result) {
+	for _, group := range groupSteps(steps, func(s config.Step) string { return s.File }) {
+		file := group[0].File
+
+		// Show what will change before anything is moved aside, so the file
+		// can still be skipped or edited.
+		var content []byte
+		if i := slices.IndexFunc(group, func(s config.Step) bool {
+			return s.Kind == config.StepWrite || s.Kind == config.StepRestore
+		}); i >= 0 {
+			accepted, ok, err := previewFile(group[i], dryRun)
+			if err != nil {
+				tap.Message(utils.Style(fmt.Sprintf("❌ [ERROR]: %s - %v", file, err), "red"))
+				time.Sleep(time.Millisecond * 100)
+				res.Failed = append(res.Failed, file)
+				continue
+			}
 
-	data, err := assets.Files.ReadFile(sourcePath)
-	if err != nil {
-		spinner.Stop(fmt.Sprintf("⚠️ [SKIPPED]: No .gitignore found at: %s", sourcePath), 1)
+			if !ok {
+				res.Skipped = append(res.Skipped, file)
+				continue
+			}
+
+			if dryRun {
+				res.Succeeded = append(res.Succeeded, file)
+				continue
+			}
+
+			content = accepted
+		}
+
+		spinner := tap.NewSpinner(tap.SpinnerOptions{
+			Delay: time.Millisecond * 100,
+		})
+
+		action := "Building"
+		if group[len(group)-1].Kind == config.StepRestore {
+			action = "Restoring"
+		}
+
+		spinner.Start(fmt.Sprintf("%s %s...", action, file))
 		time.Sleep(time.Millisecond * 100)
-		return
-	}
 
-	spinner.Message(fmt.Sprintf("📍 [FOUND]: .gitignore at: %s", sourcePath))
-	time.Sleep(time.Millisecond * 500)
+		failed := false
+		done := "CREATED"
+		backup := ""
 
-	err = utils.WriteFiles(".gitignore", data, dryRun, spinner)
-	if err != nil {
-		spinner.Stop("❌ [FAILED]: writing .gitignore", 1)
+		for _, s := range group {
+			switch s.Kind {
+			case config.StepSkip:
+				spinner.Stop(fmt.Sprintf("⚠️ [SKIPPED]: %s", s.Reason), 1)
+				time.Sleep(time.Millisecond * 100)
+				res.Skipped = append(res.Skipped, file)
+
+			case config.StepBackup:
+				if err := utils.BackupFile(s.Path, s.Source, dryRun, spinner); err != nil {
+					failed = true
+				}
+				backup = s.Source
+
+			case config.StepWrite:
+				for _, inc := range s.Includes {
+					spinner.Message(fmt.Sprintf("✅ [INCLUDE]: %s", inc))
+					time.Sleep(time.Millisecond * 100)
+				}
+
+				if len(s.Includes) > 1 {
+					spinner.Message("--- End Manifest ---")
+					time.Sleep(time.Millisecond * 100)
+				}
+
+				if s.Action == "merge" {
+					spinner.Message(fmt.Sprintf("🔑 [MERGE]: %s", changeSummary(s.Changes)))
+					time.Sleep(time.Millisecond * 100)
+				}
+
+				if hashContent(s.Content) != s.Hash {
+					spinner.Message(fmt.Sprintf("❌ [ERROR]: %s content does not match the plan", file))
+					time.Sleep(time.Millisecond * 100)
+					failed = true
+				} else if err := utils.WriteTarget(s.Path, content, dryRun, spinner); err != nil {
+					failed = true
+				} else if s.Action == "merge" && !dryRun {
+					// Keys added by an edit in the preview are not recorded;
+					// stash only owns what it planned to set.
+					if err := saveOwned(s.Path, s.Owned); err != nil {
+						spinner.Message(utils.Style(fmt.Sprintf("⚠️  [WARNING]: recording stash keys - %v", err), "orange"))
+						time.Sleep(time.Millisecond * 100)
+					}
+				}
+
+				// Files in $HOME are recorded so uninstall can put back what
+				// was there before; project files are left to the project.
+				if !failed && !dryRun && s.Path == utils.TargetPath(s.File) {
+					if err := recordWrite(s.File, s.Path, backup); err != nil {
+						spinner.Message(utils.Style(fmt.Sprintf("⚠️  [WARNING]: recording %s - %v", file, err), "orange"))
+						time.Sleep(time.Millisecond * 100)
+					}
+				}
+
+			case config.StepRestore:
+				done = "RESTORED"
+				spinner.Message(fmt.Sprintf("⏪ [RESTORING]: %s", filepath.Base(s.Source)))
+				time.Sleep(time.Millisecond * 100)
+
+				data, err := os.ReadFile(s.Source)
+				if err != nil || hashContent(data) != s.Hash {
+					spinner.Message(fmt.Sprintf("❌ [ERROR]: %s is missing or changed since it was planned", filepath.Base(s.Source)))
+					time.Sleep(time.Millisecond * 100)
+					failed = true
+				} else if err := utils.WriteTarget(s.Path, content, dryRun, spinner); err != nil {
+					failed = true
+				}
+			}
+
+			if failed {
+				break
+			}
+		}
+
+		if group[len(group)-1].Kind == config.StepSkip {
+			continue
+		}
+
+		if failed {
+			spinner.Stop(fmt.Sprintf("❌ [FAILED]: writing %s", file), 1)
+			res.Failed = append(res.Failed, file)
+		} else {
+			spinner.Stop(fmt.Sprintf("✅ [%s]: %s", done, file), 0)
+			res.Succeeded = append(res.Succeeded, file)
+		}
 		time.Sleep(time.Millisecond * 100)
-		return
 	}
+}
+
+func executeDelete(steps []config.Step, dryRun bool, res *config.Result) {
+	spinner := tap.NewSpinner(tap.SpinnerOptions{
+		Delay: time.Millisecond * 100,
+	})
 
-	*created = append(*created, ".gitignore")
-	spinner.Stop("✅ [CREATED]: .gitignore", 0)
+	spinner.Start("Scanning for backups...")
 	time.Sleep(time.Millisecond * 100)
+
+	var files []string
+	reasons := map[string]string{}
+	for _, s := range steps {
+		base := filepath.Base(s.Path)
+
+		if s.Kind == config.StepKeep {
+			spinner.Message(fmt.Sprintf("📌 [KEPT]: %s (%s)", base, s.Reason))
+			time.Sleep(time.Millisecond * 100)
+			res.Skipped = append(res.Skipped, withReason(base, s.Reason))
+			continue
+		}
+
+		files = append(files, s.Path)
+		reasons[base] = s.Reason
+	}
+
+	report := utils.DeleteFiles(files, dryRun, spinner)
+
+	spinner.Stop("Cleanup process finished", 0)
+	time.Sleep(time.Millisecond * 100)
+
+	for _, f := range report.Deleted {
+		res.Succeeded = append(res.Succeeded, withReason(f, reasons[f]))
+	}
+	res.Failed = append(res.Failed, report.Failed...)
+}
+
+func withReason(name, reason string) string {
+	if reason == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, reason)
 }
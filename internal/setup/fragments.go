@@ -0,0 +1,137 @@
+package setup
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/huffmanks/stash/internal/assets"
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+// fragment is a file found in one of the layers. Name is the path relative
+// to the layer root, e.g. common/exports/go.zsh, and Layer its index.
+type fragment struct {
+	Name  string
+	Layer int
+}
+
+type layer struct {
+	fsys  fs.FS
+	label string
+	tag   string
+}
+
+// layers stacks the embedded dotfiles, the configured sources in order and,
+// for shell trees, the user overlay in ~/.config/stash/<shell>. A file in a later layer
+// replaces the file with the same name in an earlier one.
+type layers []layer
+
+// overlayDir is where users put their own fragments for shell, e.g.
+// ~/.config/stash/zsh.
+func overlayDir(shell string) string {
+	return filepath.Join(utils.StashDir(), shell)
+}
+
+// newLayers returns the layers for one subtree of the dotfiles: a shell
+// tree such as ".zsh", "git", or "." for the files at the top.
+func newLayers(c *config.Config, sub string) (layers, error) {
+	embedded, _ := fs.Sub(assets.Files, path.Join(".dotfiles", sub))
+	ls := layers{{fsys: embedded, label: path.Join(".dotfiles", sub)}}
+
+	for _, s := range c.Sources {
+		root, label, err := openSource(s)
+		if err != nil {
+			return nil, err
+		}
+
+		fsys, _ := fs.Sub(root, sub)
+		if s.Replace {
+			ls = ls[:0]
+		}
+		ls = append(ls, layer{fsys: fsys, label: label + ":" + sub, tag: " [source]"})
+	}
+
+	if shell := strings.TrimPrefix(sub, "."); slices.Contains(config.Shells, shell) {
+		dir := overlayDir(shell)
+		ls = append(ls, layer{fsys: os.DirFS(dir), label: utils.TildePath(dir), tag: " [overlay]"})
+	}
+
+	return ls, nil
+}
+
+// readDotfile returns sub/name from the topmost layer that has it, along
+// with where it came from. When no layer has it the error is fs.ErrNotExist
+// and the source is the embedded path.
+func readDotfile(c *config.Config, sub, name string) ([]byte, string, error) {
+	ls, err := newLayers(c, sub)
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, ok := ls.Stat(name)
+	if !ok {
+		return nil, path.Join(".dotfiles", sub, name), fs.ErrNotExist
+	}
+
+	data, err := ls.ReadFile(f)
+	return data, ls.Source(f), err
+}
+
+// ReadDir returns the files with extension ext directly in dir across all
+// layers, sorted by name.
+func (ls layers) ReadDir(dir, ext string) []fragment {
+	var frags []fragment
+
+	for i, l := range ls {
+		entries, err := fs.ReadDir(l.fsys, dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || path.Ext(entry.Name()) != ext {
+				continue
+			}
+
+			f := fragment{Name: path.Join(dir, entry.Name()), Layer: i}
+			if j := slices.IndexFunc(frags, func(e fragment) bool { return e.Name == f.Name }); j >= 0 {
+				frags[j] = f
+			} else {
+				frags = append(frags, f)
+			}
+		}
+	}
+
+	slices.SortFunc(frags, func(a, b fragment) int { return strings.Compare(a.Name, b.Name) })
+	return frags
+}
+
+// Stat finds name in the topmost layer that has it.
+func (ls layers) Stat(name string) (fragment, bool) {
+	for i := len(ls) - 1; i >= 0; i-- {
+		if _, err := fs.Stat(ls[i].fsys, name); err == nil {
+			return fragment{Name: name, Layer: i}, true
+		}
+	}
+	return fragment{}, false
+}
+
+func (ls layers) ReadFile(f fragment) ([]byte, error) {
+	return fs.ReadFile(ls[f.Layer].fsys, f.Name)
+}
+
+// Embedded reports whether f comes from the embedded dotfiles.
+func (ls layers) Embedded(f fragment) bool {
+	return ls[f.Layer].tag == ""
+}
+
+// Source is how the fragment is listed in the build manifest.
+func (ls layers) Source(f fragment) string {
+	l := ls[f.Layer]
+	return l.label + "/" + f.Name + l.tag
+}
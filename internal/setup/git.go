@@ -0,0 +1,204 @@
+package setup
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/huffmanks/stash/internal/config"
+)
+
+const gitConfigTmpl = `[init]
+    defaultBranch = {{.GitBranch}}
+
+[user]
+    name = {{.GitName}}
+    email = {{.GitEmail}}
+{{- if .GitSigning}}
+    signingkey = {{.GitSigningKey}}
+{{- end}}
+
+[core]
+    excludesfile = ~/.gitignore
+
+[http]
+    postBuffer = 10485760
+{{- if .GitSigning}}
+
+[commit]
+    gpgsign = true
+
+[tag]
+    gpgsign = true
+{{- if eq .GitSigning "ssh"}}
+
+[gpg]
+    format = ssh
+{{- end}}
+{{- end}}
+{{- if .HasGitExtra "pull_rebase"}}
+
+[pull]
+    rebase = true
+{{- end}}
+{{- if .HasGitExtra "auto_setup_remote"}}
+
+[push]
+    autoSetupRemote = true
+{{- end}}
+{{- if .HasGitExtra "rerere"}}
+
+[rerere]
+    enabled = true
+{{- end}}
+{{- if .GitTool}}
+
+[diff]
+    tool = {{.GitTool}}
+
+[difftool]
+    prompt = false
+{{- with .DiffCmd}}
+
+[difftool "{{$.GitTool}}"]
+    cmd = {{.}}
+{{- end}}
+
+[merge]
+    tool = {{.GitTool}}
+
+[mergetool]
+    prompt = false
+    keepBackup = false
+{{- with .MergeCmd}}
+
+[mergetool "{{$.GitTool}}"]
+    cmd = {{.}}
+{{- end}}
+{{- end}}
+{{- if .HasGitExtra "aliases"}}
+
+[alias]
+{{- range .Aliases}}
+    {{index . 0}} = {{index . 1}}
+{{- end}}
+{{- end}}
+{{- range .Includes}}
+
+[includeIf "{{.Condition}}"]
+    path = {{.Path}}
+{{- end}}
+{{if .GHPath}}
+[credential "https://github.com"]
+    helper =
+    helper = !{{.GHPath}} auth git-credential
+[credential "https://gist.github.com"]
+    helper =
+    helper = !{{.GHPath}} auth git-credential
+{{end}}`
+
+const identityTmpl = `[user]
+    name = {{.GitName}}
+    email = {{.GitEmail}}
+{{- if .SigningKey}}
+    signingkey = {{.SigningKey}}
+{{- end}}
+`
+
+// gitInclude is an includeIf section of .gitconfig.
+type gitInclude struct {
+	Condition string
+	Path      string
+}
+
+// gitIncludes returns the includeIf sections that switch to each identity:
+// one for its directory and one for its remote, whichever are set.
+func gitIncludes(c *config.Config) []gitInclude {
+	var includes []gitInclude
+
+	for _, id := range c.GitIdentities {
+		path := "~/" + config.IdentityFile(id.Name)
+
+		if id.Dir != "" {
+			// A trailing slash makes git match everything below the
+			// directory, not just the directory itself.
+			dir := strings.TrimSuffix(id.Dir, "/") + "/"
+			includes = append(includes, gitInclude{Condition: "gitdir:" + dir, Path: path})
+		}
+
+		if id.Remote != "" {
+			includes = append(includes, gitInclude{Condition: "hasconfig:remote.*.url:" + id.Remote, Path: path})
+		}
+	}
+
+	return includes
+}
+
+// gitToolCmds are the difftool and mergetool commands for tools git has
+// no built-in support for.
+var gitToolCmds = map[string][2]string{
+	"vscode": {"code --wait --diff $LOCAL $REMOTE", "code --wait $MERGED"},
+}
+
+// gitAliases is the curated alias set behind the "aliases" git extra.
+var gitAliases = [][2]string{
+	{"st", "status -sb"},
+	{"co", "checkout"},
+	{"sw", "switch"},
+	{"br", "branch"},
+	{"ci", "commit"},
+	{"amend", "commit --amend --no-edit"},
+	{"unstage", "restore --staged"},
+	{"last", "log -1 HEAD --stat"},
+	{"lg", "log --graph --pretty=format:'%C(yellow)%h%Creset %s %C(dim)(%cr, %an)%Creset%C(auto)%d'"},
+}
+
+func renderGitConfig(c *config.Config) ([]byte, error) {
+	ghPath, err := exec.LookPath("gh")
+	if err == nil {
+		c.GHPath = ghPath
+	} else {
+		c.GHPath = ""
+	}
+
+	tmpl, err := template.New("gitconfig").Parse(gitConfigTmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	data := struct {
+		*config.Config
+		DiffCmd  string
+		MergeCmd string
+		Aliases  [][2]string
+		Includes []gitInclude
+	}{
+		Config:   c,
+		DiffCmd:  gitToolCmds[c.GitTool][0],
+		MergeCmd: gitToolCmds[c.GitTool][1],
+		Aliases:  gitAliases,
+		Includes: gitIncludes(c),
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func renderIdentity(id config.GitIdentity) ([]byte, error) {
+	tmpl, err := template.New("identity").Parse(identityTmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, id); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
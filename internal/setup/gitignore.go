@@ -0,0 +1,123 @@
+package setup
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+// renderGitIgnore composes the global .gitignore from the fragments in
+// git/ignore selected by c, any other fragment a source adds, a whole
+// git/.gitignore from a source and the patterns from git_ignore_patterns,
+// in that order. A pattern is only written the first time it appears; in
+// managed mode patterns the user already has outside the stash block are
+// left out too. It returns the content and the fragments it was built from.
+func renderGitIgnore(c *config.Config) ([]byte, []string, error) {
+	ls, err := newLayers(c, "git")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var frags []fragment
+	for _, name := range c.IgnoreFragments() {
+		if f, ok := ls.Stat(path.Join("ignore", name+".gitignore")); ok {
+			frags = append(frags, f)
+		}
+	}
+
+	for _, f := range ls.ReadDir("ignore", ".gitignore") {
+		known := slices.ContainsFunc(config.GitIgnoreFragments, func(k config.IgnoreFragment) bool {
+			return "ignore/"+k.Name+".gitignore" == f.Name
+		})
+		if !known && !ls.Embedded(f) {
+			frags = append(frags, f)
+		}
+	}
+
+	if f, ok := ls.Stat(".gitignore"); ok && !ls.Embedded(f) {
+		frags = append(frags, f)
+	}
+
+	seen := map[string]bool{}
+	if managedFile(c, ".gitignore") {
+		current, _ := os.ReadFile(utils.TargetPath(".gitignore"))
+		for _, line := range userLines(current) {
+			seen[strings.TrimSpace(line)] = true
+		}
+	}
+
+	var sections []string
+	var included []string
+
+	for _, f := range frags {
+		data, err := ls.ReadFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if section, ok := ignoreSection(string(data), seen); ok {
+			sections = append(sections, section)
+		}
+		included = append(included, ls.Source(f))
+	}
+
+	if len(c.GitIgnorePatterns) > 0 {
+		user := "# ==============================\n# Custom Patterns\n# ==============================\n" + strings.Join(c.GitIgnorePatterns, "\n")
+		if section, ok := ignoreSection(user, seen); ok {
+			sections = append(sections, section)
+		}
+	}
+
+	if len(sections) == 0 {
+		return nil, included, nil
+	}
+
+	return []byte(strings.Join(sections, "\n\n") + "\n"), included, nil
+}
+
+// ignoreSection drops the patterns of a fragment that are in seen and adds
+// the rest to it. It reports false when no pattern is left, so a fragment
+// is not written as a header alone.
+func ignoreSection(data string, seen map[string]bool) (string, bool) {
+	var lines []string
+	patterns := 0
+
+	for _, line := range strings.Split(strings.TrimRight(data, "\n"), "\n") {
+		pattern := strings.TrimSpace(line)
+		if pattern != "" && !strings.HasPrefix(pattern, "#") {
+			if seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			patterns++
+		}
+		lines = append(lines, strings.TrimRight(line, " \t"))
+	}
+
+	return strings.Join(lines, "\n"), patterns > 0
+}
+
+// userLines returns the lines of a managed file outside the stash block.
+func userLines(current []byte) []string {
+	var lines []string
+	inBlock := false
+
+	for _, line := range strings.Split(string(current), "\n") {
+		switch strings.TrimSpace(line) {
+		case managedBegin:
+			inBlock = true
+		case managedEnd:
+			inBlock = false
+		default:
+			if !inBlock {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,234 @@
+package setup
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+)
+
+// gitKey is one key of a git config file with all the values stash sets
+// for it, in order. Keys such as credential.helper take several.
+type gitKey struct {
+	Section string // lower case
+	Sub     string // case sensitive, "" for none
+	Header  string // the section header as stash writes it
+	Name    string // lower case
+	Key     string // as written
+	Values  []string
+}
+
+func (k gitKey) String() string {
+	if k.Sub != "" {
+		return k.Section + "." + k.Sub + "." + k.Key
+	}
+	return k.Section + "." + k.Key
+}
+
+// gitLine is a line of a git config file with the section it is in.
+type gitLine struct {
+	Text    string
+	Section string
+	Sub     string
+	Header  bool
+	Name    string // lower case key name, "" for anything but a key
+	Value   string
+}
+
+// mergeGitConfigFile applies the keys of the rendered .gitconfig to the
+// file at path, leaving sections and keys stash does not set alone.
+func mergeGitConfigFile(path string, rendered []byte) (*keyMerge, error) {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	content, changes := mergeGitConfig(current, rendered)
+	return &keyMerge{Content: content, Changes: changes}, nil
+}
+
+// mergeGitConfig sets every key of desired on current the way
+// `git config --global --replace-all` would: existing values of a key are
+// replaced where the first one was, a missing key is added to the end of
+// its section, and a missing section is appended to the file.
+func mergeGitConfig(current, desired []byte) ([]byte, []string) {
+	lines := parseGitLines(current)
+	var changes []string
+
+	// New keys follow the file's own indentation, tabs as git writes them
+	// or stash's four spaces.
+	fileIndent := "    "
+	if i := slices.IndexFunc(lines, func(l gitLine) bool { return l.Name != "" }); i >= 0 {
+		fileIndent = lineIndent(lines[i].Text)
+	}
+
+	for _, k := range gitKeys(desired) {
+		var at []int
+		var values []string
+		for i, l := range lines {
+			if l.Name == k.Name && l.Section == k.Section && l.Sub == k.Sub {
+				at = append(at, i)
+				values = append(values, l.Value)
+			}
+		}
+
+		if slices.Equal(values, k.Values) {
+			continue
+		}
+
+		indent := fileIndent
+		if len(at) > 0 {
+			indent = lineIndent(lines[at[0]].Text)
+		}
+
+		var add []gitLine
+		for _, v := range k.Values {
+			text := indent + k.Key + " = " + v
+			if v == "" {
+				text = indent + k.Key + " ="
+			}
+			add = append(add, gitLine{Text: text, Section: k.Section, Sub: k.Sub, Name: k.Name, Value: v})
+		}
+
+		switch {
+		case len(at) > 0:
+			changes = append(changes, "changed "+k.String())
+			pos := at[0]
+			for j := len(at) - 1; j >= 0; j-- {
+				lines = slices.Delete(lines, at[j], at[j]+1)
+			}
+			lines = slices.Insert(lines, pos, add...)
+
+		default:
+			changes = append(changes, "added "+k.String())
+
+			// After the last key of the last block of the section, so the
+			// blank line before the next section stays where it is.
+			end := -1
+			for i, l := range lines {
+				if l.Section == k.Section && l.Sub == k.Sub && (l.Header || l.Name != "") {
+					end = i + 1
+				}
+			}
+
+			if end < 0 {
+				for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1].Text) == "" {
+					lines = lines[:len(lines)-1]
+				}
+				if len(lines) > 0 {
+					lines = append(lines, gitLine{})
+				}
+				lines = append(lines, gitLine{Text: k.Header, Section: k.Section, Sub: k.Sub, Header: true})
+				end = len(lines)
+			}
+
+			lines = slices.Insert(lines, end, add...)
+		}
+	}
+
+	if len(changes) == 0 {
+		return current, nil
+	}
+
+	var out strings.Builder
+	for _, l := range lines {
+		out.WriteString(l.Text + "\n")
+	}
+	return []byte(out.String()), changes
+}
+
+func lineIndent(text string) string {
+	return text[:len(text)-len(strings.TrimLeft(text, " \t"))]
+}
+
+// gitKeys returns the keys set in a git config file, grouping the values
+// of repeated keys.
+func gitKeys(data []byte) []gitKey {
+	var keys []gitKey
+	header := ""
+
+	for _, l := range parseGitLines(data) {
+		if l.Header {
+			header = strings.TrimSpace(l.Text)
+			continue
+		}
+		if l.Name == "" {
+			continue
+		}
+
+		if i := slices.IndexFunc(keys, func(k gitKey) bool {
+			return k.Name == l.Name && k.Section == l.Section && k.Sub == l.Sub
+		}); i >= 0 {
+			keys[i].Values = append(keys[i].Values, l.Value)
+			continue
+		}
+
+		key, _, _ := strings.Cut(strings.TrimSpace(l.Text), "=")
+		keys = append(keys, gitKey{
+			Section: l.Section,
+			Sub:     l.Sub,
+			Header:  header,
+			Name:    l.Name,
+			Key:     strings.TrimSpace(key),
+			Values:  []string{l.Value},
+		})
+	}
+
+	return keys
+}
+
+func parseGitLines(data []byte) []gitLine {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var lines []gitLine
+	section, sub := "", ""
+
+	for _, text := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		l := gitLine{Text: text}
+		trimmed := strings.TrimSpace(text)
+
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			section, sub = parseGitHeader(trimmed)
+			l.Header = true
+		case trimmed == "", strings.HasPrefix(trimmed, "#"), strings.HasPrefix(trimmed, ";"):
+		default:
+			key, value, found := strings.Cut(trimmed, "=")
+			l.Name = strings.ToLower(strings.TrimSpace(key))
+			l.Value = strings.TrimSpace(value)
+			if !found {
+				// A key without a value is a boolean set to true.
+				l.Value = "true"
+			}
+		}
+
+		l.Section, l.Sub = section, sub
+		lines = append(lines, l)
+	}
+
+	return lines
+}
+
+// parseGitHeader reads [section], [section "sub"] or the legacy
+// [section.sub] form.
+func parseGitHeader(header string) (string, string) {
+	inner := strings.TrimPrefix(header, "[")
+	if end := strings.LastIndex(inner, "]"); end >= 0 {
+		inner = inner[:end]
+	}
+
+	if name, rest, ok := strings.Cut(inner, " "); ok {
+		sub := strings.TrimSpace(rest)
+		sub = strings.TrimSuffix(strings.TrimPrefix(sub, `"`), `"`)
+		sub = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(sub)
+		return strings.ToLower(name), sub
+	}
+
+	if name, sub, ok := strings.Cut(inner, "."); ok {
+		return strings.ToLower(name), strings.ToLower(sub)
+	}
+
+	return strings.ToLower(inner), ""
+}
@@ -0,0 +1,63 @@
+package setup
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeGitConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		desired string
+		want    string
+		changes []string
+	}{
+		{
+			name:    "new file",
+			current: "",
+			desired: "[user]\n    name = Ada\n",
+			want:    "[user]\n    name = Ada\n",
+			changes: []string{"added user.name"},
+		},
+		{
+			name:    "keeps sections stash does not set",
+			current: "[lfs]\n\trepositoryformatversion = 0\n[user]\n\tname = Old\n\n[safe]\n\tdirectory = /srv/repo\n",
+			desired: "[user]\n    name = Ada\n    email = ada@example.com\n",
+			want:    "[lfs]\n\trepositoryformatversion = 0\n[user]\n\tname = Ada\n\temail = ada@example.com\n\n[safe]\n\tdirectory = /srv/repo\n",
+			changes: []string{"changed user.name", "added user.email"},
+		},
+		{
+			name:    "appends missing sections with subsections",
+			current: "[core]\n\teditor = vim\n",
+			desired: "[url \"git@github.com:\"]\n    insteadOf = https://github.com/\n",
+			want:    "[core]\n\teditor = vim\n\n[url \"git@github.com:\"]\n\tinsteadOf = https://github.com/\n",
+			changes: []string{"added url.git@github.com:.insteadOf"},
+		},
+		{
+			name:    "keys and sections are case insensitive",
+			current: "[User]\n\tName = Ada\n",
+			desired: "[user]\n    name = Ada\n",
+			want:    "[User]\n\tName = Ada\n",
+		},
+		{
+			name:    "replaces every value of a multi-valued key",
+			current: "[credential]\n\thelper = \n\thelper = store\n\thelper = cache\n",
+			desired: "[credential]\n    helper =\n    helper = osxkeychain\n",
+			want:    "[credential]\n\thelper =\n\thelper = osxkeychain\n",
+			changes: []string{"changed credential.helper"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := mergeGitConfig([]byte(tt.current), []byte(tt.desired))
+			if string(got) != tt.want {
+				t.Errorf("content\n got: %q\nwant: %q", got, tt.want)
+			}
+			if !slices.Equal(changes, tt.changes) {
+				t.Errorf("changes = %q, want %q", changes, tt.changes)
+			}
+		})
+	}
+}
@@ -1,111 +1,184 @@
 package setup
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
-	"runtime"
-	"slices"
 	"strings"
 	"time"
 
 	"github.com/huffmanks/stash/internal/assets"
+	"github.com/huffmanks/stash/internal/catalog"
 	"github.com/huffmanks/stash/internal/config"
 	"github.com/huffmanks/stash/internal/utils"
 	"github.com/yarlson/tap"
 )
 
-func installSystemPkgs(c *config.Config, dryRun bool, progress *tap.Progress, failedPkgs *[]string) error {
-	for _, pkg := range c.SelectedPkgs {
-		var err error
+// planPackage turns one catalog package into the steps that install it.
+// action is "install" for missing packages, or "reinstall"/"upgrade" for
+// ones that are already present.
+func planPackage(pm string, pkg catalog.Package, action, goos, arch string) ([]config.Step, error) {
+	var step config.Step
 
-		if runtime.GOOS != "linux" && pkg != "docker" {
-			msg := fmt.Sprintf("📦 Installing %s...", pkg)
-			progress.Message(msg)
-			time.Sleep(time.Millisecond * 100)
+	method, custom := pkg.MethodFor(goos)
 
-			if dryRun {
-				time.Sleep(time.Millisecond * 500)
-			}
+	switch {
+	case !custom:
+		cmdStr, err := pmCmd(pm, action, pkg.NameFor(pm))
+		if err != nil {
+			return nil, err
+		}
+		step = config.Step{Kind: config.StepInstall, Package: pkg.Name, Manager: pm, Command: cmdStr}
+	case method.Clone != "" && action == "upgrade":
+		home, _ := os.UserHomeDir()
+		target := path.Join(home, ".zsh", pkg.Name)
+		step = config.Step{Kind: config.StepScript, Package: pkg.Name, Path: target, Command: fmt.Sprintf("git -C %s pull --ff-only", target)}
+	case method.Skip != "":
+		return []config.Step{{Kind: config.StepSkip, Package: pkg.Name, Reason: method.Skip}}, nil
+	case method.Script != "":
+		step = config.Step{Kind: config.StepScript, Package: pkg.Name, Command: method.Script}
+	case method.URL != "":
+		shell := method.Shell
+		if shell == "" {
+			shell = "sh"
 		}
+		step = config.Step{Kind: config.StepScript, Package: pkg.Name, Source: method.URL, Command: fmt.Sprintf("curl -fsSL %s | %s", method.URL, shell)}
+	case method.Asset != "":
+		tempScript := path.Join(os.TempDir(), path.Base(method.Asset))
+		step = config.Step{Kind: config.StepScript, Package: pkg.Name, Asset: method.Asset, Path: tempScript, Command: fmt.Sprintf("sudo sh %s", tempScript)}
+	case method.Clone != "":
+		home, _ := os.UserHomeDir()
+		step = config.Step{Kind: config.StepClone, Package: pkg.Name, Source: method.Clone, Path: path.Join(home, ".zsh", pkg.Name)}
+	case method.Builtin == "go":
+		step = config.Step{Kind: config.StepScript, Package: pkg.Name, Command: goInstallCmd(goos, arch)}
+	default:
+		return nil, fmt.Errorf("%s: no usable install method for %s", pkg.Name, goos)
+	}
+
+	if action != "install" {
+		step.Action = action
+	}
 
-		isZshPlugin := strings.HasPrefix(pkg, "zsh-") && runtime.GOOS == "linux"
+	steps := []config.Step{step}
+	for _, h := range pkg.HooksFor(goos) {
+		steps = append(steps, config.Step{Kind: config.StepHook, Package: pkg.Name, Command: h.Command, Optional: true})
+	}
 
-		switch {
-		case pkg == "bat":
-			err = installViaPM(c.PackageManager, pkg, dryRun, progress)
-			if err == nil && runtime.GOOS == "linux" {
-				aliasCmd := `if command -v batcat &>/dev/null && ! command -v bat &>/dev/null; then sudo update-alternatives --install /usr/local/bin/bat bat /usr/bin/batcat 1; fi`
-				utils.RunCmd(aliasCmd, dryRun, progress)
-			}
-		case pkg == "bun":
-			err = utils.RunCmd("curl -fsSL https://bun.com/install | bash", dryRun, progress)
-		case pkg == "docker":
-			if runtime.GOOS == "linux" {
-				err = installDocker(dryRun, progress)
+	return steps, nil
+}
+
+// runInstallStep executes one install, script, hook or clone step.
+func runInstallStep(s config.Step, dryRun bool, progress *tap.Progress) error {
+	switch s.Kind {
+	case config.StepClone:
+		if s.Action == "reinstall" && !dryRun {
+			if err := os.RemoveAll(s.Path); err != nil {
+				return err
 			}
-		case pkg == "go":
-			err = installGo(dryRun, progress)
-		case pkg == "nvm":
-			err = utils.RunCmd("curl -o- https://raw.githubusercontent.com/nvm-sh/nvm/v0.40.2/install.sh | bash", dryRun, progress)
-		case pkg == "pnpm":
-			err = utils.RunCmd("curl -fsSL https://get.pnpm.io/install.sh | sh -", dryRun, progress)
-		case pkg == "zsh":
-			err = installViaPM(c.PackageManager, pkg, dryRun, progress)
-			if err == nil && runtime.GOOS == "linux" {
-				utils.RunCmd("sudo chsh -s $(which zsh) $(whoami)", dryRun, progress)
+		}
+		return gitClone(s.Source, s.Path, dryRun, progress)
+	case config.StepInstall, config.StepScript, config.StepHook:
+		if s.Asset != "" && !dryRun {
+			if err := writeAssetScript(s.Asset, s.Path, progress); err != nil {
+				return err
 			}
-		case isZshPlugin:
-			repo := fmt.Sprintf("https://github.com/zsh-users/%s", pkg)
-			home, _ := os.UserHomeDir()
-			target := path.Join(home, ".zsh", pkg)
-			err = gitClone(repo, target, dryRun, progress)
-		default:
-			err = installViaPM(c.PackageManager, pkg, dryRun, progress)
+			defer os.Remove(s.Path)
 		}
+		return utils.RunCmd(s.Command, dryRun, progress)
+	}
 
-		if err != nil {
-			if !slices.Contains(*failedPkgs, pkg) {
-				*failedPkgs = append(*failedPkgs, pkg)
-			}
+	return fmt.Errorf("unexpected %s step for %s", s.Kind, s.Package)
+}
 
-			progress.Advance(1, fmt.Sprintf("❌ [%s]: failed", pkg))
-		} else {
-			progress.Advance(1, fmt.Sprintf("✅ [%s]: installed", pkg))
-		}
+// pmCmd builds the non-interactive package manager command for action,
+// which is one of install, reinstall or upgrade.
+func pmCmd(pm, action, resolvedPkg string) (string, error) {
+	templates, ok := pmCommands[pm]
+	if !ok {
+		return "", fmt.Errorf("⚠️ [WARNING]: Unsupported package manager: %q", pm)
+	}
 
-		time.Sleep(time.Millisecond * 500)
+	tmpl, ok := templates[action]
+	if !ok {
+		tmpl = templates["install"]
+	}
 
+	if pm == "nix" {
+		resolvedPkg = nixChannel() + "." + resolvedPkg
 	}
-	return nil
+
+	return fmt.Sprintf(tmpl, resolvedPkg), nil
 }
 
-func installViaPM(pm, pkg string, dryRun bool, progress *tap.Progress) error {
-	resolvedPkg := utils.ResolvePkgName(pm, pkg)
-	var cmdStr string
+var pmCommands = map[string]map[string]string{
+	"apt": {
+		"install":   "sudo apt install -y %s",
+		"reinstall": "sudo apt install --reinstall -y %s",
+		"upgrade":   "sudo apt install --only-upgrade -y %s",
+	},
+	"dnf": {
+		"install":   "sudo dnf install -y %s",
+		"reinstall": "sudo dnf reinstall -y %s",
+		"upgrade":   "sudo dnf upgrade -y %s",
+	},
+	"homebrew": {
+		"install":   "brew install %s",
+		"reinstall": "brew reinstall %s",
+		"upgrade":   "brew upgrade %s",
+	},
+	"macports": {
+		"install":   "sudo port install %s",
+		"reinstall": "sudo port -f install %s",
+		"upgrade":   "sudo port upgrade %s",
+	},
+	"pacman": {
+		"install": "sudo pacman -S --noconfirm %s",
+		"upgrade": "sudo pacman -S --noconfirm --needed %s",
+	},
+	"zypper": {
+		"install":   "sudo zypper --non-interactive install --auto-agree-with-licenses %s",
+		"reinstall": "sudo zypper --non-interactive install --force --auto-agree-with-licenses %s",
+		"upgrade":   "sudo zypper --non-interactive update --auto-agree-with-licenses %s",
+	},
+	"apk": {
+		"install":   "sudo apk add --no-cache %s",
+		"reinstall": "sudo apk fix --reinstall %s",
+		"upgrade":   "sudo apk add --no-cache --upgrade %s",
+	},
+	"xbps": {
+		"install":   "sudo xbps-install -Sy %s",
+		"reinstall": "sudo xbps-install -Syf %s",
+		"upgrade":   "sudo xbps-install -Suy %s",
+	},
+	"nix": {
+		"install": "nix-env -iA %s",
+		"upgrade": "nix-env -uA %s",
+	},
+}
 
-	switch pm {
-	case "apt":
-		cmdStr = fmt.Sprintf("sudo apt install -y %s", resolvedPkg)
-	case "dnf":
-		cmdStr = fmt.Sprintf("sudo dnf install -y %s", resolvedPkg)
-	case "homebrew":
-		cmdStr = fmt.Sprintf("brew install %s", resolvedPkg)
-	case "macports":
-		cmdStr = fmt.Sprintf("sudo port install %s", resolvedPkg)
-	case "pacman":
-		cmdStr = fmt.Sprintf("sudo pacman -S --noconfirm %s", resolvedPkg)
-	}
+// pmRemoveCommands uninstall a package by the name its manager knows it
+// by. nix-env removes by name rather than attribute, so no channel prefix.
+var pmRemoveCommands = map[string]string{
+	"apt":      "sudo apt remove -y %s",
+	"dnf":      "sudo dnf remove -y %s",
+	"homebrew": "brew uninstall %s",
+	"macports": "sudo port uninstall %s",
+	"pacman":   "sudo pacman -R --noconfirm %s",
+	"zypper":   "sudo zypper --non-interactive remove %s",
+	"apk":      "sudo apk del %s",
+	"xbps":     "sudo xbps-remove -y %s",
+	"nix":      "nix-env -e %s",
+}
 
-	if cmdStr == "" {
-		return fmt.Errorf("⚠️ [WARNING]: Unsupported package manager.")
+// pmRemoveCmd builds the command that uninstalls resolvedPkg with pm.
+func pmRemoveCmd(pm, resolvedPkg string) (string, error) {
+	tmpl, ok := pmRemoveCommands[pm]
+	if !ok {
+		return "", fmt.Errorf("⚠️ [WARNING]: Unsupported package manager: %q", pm)
 	}
-
-	return utils.RunCmd(cmdStr, dryRun, progress)
+	return fmt.Sprintf(tmpl, resolvedPkg), nil
 }
 
 func gitClone(repoURL, targetPath string, dryRun bool, progress *tap.Progress) error {
@@ -133,103 +206,86 @@ func gitClone(repoURL, targetPath string, dryRun bool, progress *tap.Progress) e
 		progress.Message(msg)
 		time.Sleep(time.Millisecond * 100)
 
-		return fmt.Errorf("%s", msg)
+		return nil
 	}
 
 	cmdStr := fmt.Sprintf("git clone --depth 1 %s %s", repoURL, targetPath)
 	return utils.RunCmd(cmdStr, dryRun, progress)
 }
 
-func installDocker(dryRun bool, progress *tap.Progress) error {
-	tempScript := path.Join(os.TempDir(), "get-docker.sh")
-
-	if !dryRun {
-		data, err := assets.Files.ReadFile("scripts/get-docker.sh")
-		if err != nil {
-			msg := fmt.Sprintf("❌ [ERROR]: Failed to read docker script: %v", err)
-			progress.Message(msg)
-			time.Sleep(time.Millisecond * 100)
+// nixChannel returns the channel attribute prefix nix-env installs from.
+// NixOS names its system channel "nixos", everywhere else it is "nixpkgs".
+func nixChannel() string {
+	if _, err := os.Stat("/etc/NIXOS"); err == nil {
+		return "nixos"
+	}
+	return "nixpkgs"
+}
 
-			return fmt.Errorf("read docker script: %w", err)
-		}
+func writeAssetScript(asset, target string, progress *tap.Progress) error {
+	data, err := assets.Files.ReadFile(asset)
+	if err != nil {
+		msg := fmt.Sprintf("❌ [ERROR]: Failed to read %s: %v", asset, err)
+		progress.Message(msg)
+		time.Sleep(time.Millisecond * 100)
 
-		err = os.WriteFile(tempScript, data, 0755)
-		if err != nil {
-			msg := fmt.Sprintf("❌ [ERROR]: Failed to write temp script: %v", err)
-			progress.Message(msg)
-			time.Sleep(time.Millisecond * 100)
+		return fmt.Errorf("read %s: %w", asset, err)
+	}
 
-			return fmt.Errorf("write temp script: %w", err)
-		}
+	err = os.WriteFile(target, data, 0755)
+	if err != nil {
+		msg := fmt.Sprintf("❌ [ERROR]: Failed to write temp script: %v", err)
+		progress.Message(msg)
+		time.Sleep(time.Millisecond * 100)
 
-		defer os.Remove(tempScript)
+		return fmt.Errorf("write temp script: %w", err)
 	}
 
-	return utils.RunCmd(fmt.Sprintf("sudo sh %s", tempScript), dryRun, progress)
+	return nil
 }
 
-func installGo(dryRun bool, progress *tap.Progress) error {
-	version := "1.25.5"
-	if !dryRun {
-		out, err := exec.Command("sh", "-c", "curl -s 'https://go.dev/VERSION?m=text' | head -n 1").Output()
-		if err == nil {
-			version = strings.TrimPrefix(strings.TrimSpace(string(out)), "go")
-		}
-	}
+// goInstallCmd downloads the latest Go release. The version is looked up
+// when the step runs, so planning stays offline and the step is the same
+// from one release to the next.
+func goInstallCmd(goos, arch string) string {
+	resolve := `v=$(curl -fsSL 'https://go.dev/VERSION?m=text' | head -n 1); case "$v" in go*) ;; *) v=go1.25.5 ;; esac; `
 
-	var cmd string
-	if runtime.GOOS == "darwin" {
-		url := fmt.Sprintf("https://go.dev/dl/go%s.darwin-%s.pkg", version, runtime.GOARCH)
-		cmd = fmt.Sprintf("curl -LO %s && sudo installer -pkg go%s.darwin-%s.pkg -target /", url, version, runtime.GOARCH)
-	} else {
-		url := fmt.Sprintf("https://go.dev/dl/go%s.linux-%s.tar.gz", version, runtime.GOARCH)
-		cmd = fmt.Sprintf("curl -L %s | sudo tar -C /usr/local -xzf -", url)
+	if goos == "darwin" {
+		pkg := fmt.Sprintf(`"$v".darwin-%s.pkg`, arch)
+		return resolve + fmt.Sprintf(`curl -fLO https://go.dev/dl/%s && sudo installer -pkg %s -target /`, pkg, pkg)
 	}
 
-	return utils.RunCmd(cmd, dryRun, progress)
+	return resolve + fmt.Sprintf(`curl -fL https://go.dev/dl/"$v".linux-%s.tar.gz | sudo tar -C /usr/local -xzf -`, arch)
 }
 
-func ensureMacOSPrereqs(pm string, dryRun bool, progress *tap.Progress, failedPkgs *[]string) {
-	_, err := exec.LookPath("xcode-select")
-	if err != nil {
-		if dryRun {
-			progress.Advance(1, utils.Style("___ [DRY_RUN]: Would ensure xcode-select is installed ___", "orange"))
-			time.Sleep(time.Millisecond * 100)
-		} else {
-			cmdErr := utils.RunCmd("xcode-select --install", dryRun, progress)
-			if cmdErr != nil {
-				*failedPkgs = append(*failedPkgs, "xcode")
-			}
-			progress.Advance(1, "📦 [INSTALLING]: Xcode Command Line Tools...")
-			time.Sleep(time.Millisecond * 100)
-		}
+// planMacOSPrereqs returns the steps that bootstrap Xcode Command Line Tools
+// and the chosen package manager when they are missing.
+func planMacOSPrereqs(pm string) ([]config.Step, error) {
+	var steps []config.Step
+
+	if !utils.CommandExists("xcode-select") {
+		steps = append(steps, config.Step{Kind: config.StepScript, Package: "xcode", Command: "xcode-select --install"})
 	}
 
 	switch pm {
 	case "homebrew":
-		if _, err := exec.LookPath("brew"); err != nil {
-			cmdErr := utils.RunCmd(`/bin/bash -c "$(curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh)"`, dryRun, progress)
-
-			if cmdErr != nil {
-				*failedPkgs = append(*failedPkgs, "homebrew")
-			}
-			progress.Advance(1, "📦 [INSTALLING]: Homebrew...")
-			time.Sleep(time.Millisecond * 100)
+		if !utils.CommandExists("brew") {
+			steps = append(steps, config.Step{Kind: config.StepScript, Package: "homebrew", Command: `/bin/bash -c "$(curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh)"`})
 		}
 	case "macports":
-		if _, err := exec.LookPath("port"); err != nil {
-			cmdErr := installMacPorts(dryRun, progress)
-
-			if cmdErr != nil {
-				*failedPkgs = append(*failedPkgs, "macports")
+		if !utils.CommandExists("port") {
+			cmdStr, err := macPortsInstallCmd()
+			if err != nil {
+				return nil, err
 			}
-			progress.Advance(1, "📦 [INSTALLING]: Macports...")
-			time.Sleep(time.Millisecond * 100)
+			steps = append(steps, config.Step{Kind: config.StepScript, Package: "macports", Command: cmdStr})
 		}
 	}
+
+	return steps, nil
 }
 
-func installMacPorts(dryRun bool, progress *tap.Progress) error {
+func macPortsInstallCmd() (string, error) {
 	out, _ := exec.Command("sw_vers", "-productVersion").Output()
 	versionStr := strings.TrimSpace(string(out))
 
@@ -248,59 +304,12 @@ func installMacPorts(dryRun bool, progress *tap.Progress) error {
 	case strings.HasPrefix(versionStr, "11"):
 		osName = "11-BigSur"
 	default:
-		msg := fmt.Sprintf("⚠️ [WARNING]: macOS %s not in auto-install list.", versionStr)
-		progress.Message(msg)
-		time.Sleep(time.Millisecond * 100)
-		return fmt.Errorf("macOS %s not in auto-install list", versionStr)
-	}
-
-	pkgName := "MacPorts-Latest.pkg"
-	downloadURL := ""
-
-	if !dryRun {
-		resp, err := http.Get("https://api.github.com/repos/macports/macports-base/releases/latest")
-		if err == nil {
-			defer resp.Body.Close()
-			var release config.MacPortRelease
-
-			if err := json.NewDecoder(resp.Body).Decode(&release); err == nil {
-				for _, asset := range release.Assets {
-					if strings.Contains(asset.Name, osName) && strings.HasSuffix(asset.Name, ".pkg") {
-						pkgName = asset.Name
-						downloadURL = asset.BrowserDownloadURL
-						break
-					}
-				}
-			}
-		}
-	}
-
-	if downloadURL == "" {
-		downloadURL = fmt.Sprintf("https://distfiles.macports.org/MacPorts/%s", pkgName)
+		return "", fmt.Errorf("macOS %s not in auto-install list", versionStr)
 	}
 
-	if dryRun {
-		msg := fmt.Sprintf(utils.Style("___ [DRY_RUN]: %s. Would download: %s ___", "orange"), versionStr, downloadURL)
-		progress.Message(msg)
-		time.Sleep(time.Millisecond * 100)
-		return nil
-	}
-
-	dlMsg := fmt.Sprintf("↓ [DOWNLOADING]: MacPorts %s for %s...", pkgName, osName)
-	progress.Message(dlMsg)
-	time.Sleep(time.Millisecond * 100)
+	// The release is looked up when the step runs, like goInstallCmd.
+	find := fmt.Sprintf(`url=$(curl -fsSL https://api.github.com/repos/macports/macports-base/releases/latest | grep -o 'https://[^"]*-%s\.pkg' | head -n 1); `, osName)
+	fallback := `[ -n "$url" ] || url=https://distfiles.macports.org/MacPorts/MacPorts-Latest.pkg; pkg=$(basename "$url"); `
 
-	cmdErrDownload := utils.RunCmd(fmt.Sprintf("curl -O %s", downloadURL), false, progress)
-	if cmdErrDownload != nil {
-		return cmdErrDownload
-	}
-
-	cmdErrInstall := utils.RunCmd(fmt.Sprintf("sudo installer -pkg %s -target /", pkgName), false, progress)
-	_ = os.Remove(pkgName)
-
-	if cmdErrInstall != nil {
-		return cmdErrInstall
-	}
-
-	return nil
+	return find + fallback + `curl -fLO "$url" && sudo installer -pkg "$pkg" -target /; status=$?; rm -f "$pkg"; exit $status`, nil
 }
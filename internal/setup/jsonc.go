@@ -0,0 +1,384 @@
+package setup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonObject is a JSON object as written in a JSONC file such as VS Code's
+// settings.json: members keep their order and the comments around them so
+// a merge only touches the keys it changes.
+type jsonObject struct {
+	Lead   []string // comments before the opening brace, top level only
+	Fields []*jsonField
+	Tail   []string // comments after the last member
+	After  []string // comments after the closing brace, top level only
+}
+
+type jsonField struct {
+	Key      string
+	Comments []string // comment lines above the member
+	Inline   string   // comment after the member on the same line
+	Value    json.RawMessage
+	Text     []byte      // Value as written in the file, kept while unchanged
+	Object   *jsonObject // set instead of Value for object values
+}
+
+func (o *jsonObject) field(key string) (int, *jsonField) {
+	for i, f := range o.Fields {
+		if f.Key == key {
+			return i, f
+		}
+	}
+	return -1, nil
+}
+
+// raw returns the value as compact JSON, comments left out.
+func (f *jsonField) raw() json.RawMessage {
+	if f.Object == nil {
+		return f.Value
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range f.Object.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := marshalNoEscape(m.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(m.raw())
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// parseJSONC reads an object allowing // and /* */ comments and trailing
+// commas. Empty input is an empty object.
+func parseJSONC(data []byte) (*jsonObject, error) {
+	p := &jsoncParser{data: data}
+
+	lead := p.comments()
+	if p.eof() {
+		return &jsonObject{Lead: lead}, nil
+	}
+
+	obj, err := p.object()
+	if err != nil {
+		return nil, err
+	}
+	obj.Lead = lead
+
+	obj.After = p.comments()
+	if !p.eof() {
+		return nil, p.errorf("unexpected data after the object")
+	}
+
+	return obj, nil
+}
+
+type jsoncParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *jsoncParser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *jsoncParser) errorf(format string, args ...any) error {
+	line := bytes.Count(p.data[:min(p.pos, len(p.data))], []byte("\n")) + 1
+	return fmt.Errorf("parse json: line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *jsoncParser) space() {
+	for !p.eof() && strings.IndexByte(" \t\r\n", p.data[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// comment reads one comment at the current position, or returns "".
+func (p *jsoncParser) comment() string {
+	rest := p.data[p.pos:]
+
+	switch {
+	case bytes.HasPrefix(rest, []byte("//")):
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			end = len(rest)
+		}
+		p.pos += end
+		return strings.TrimRight(string(rest[:end]), " \t\r")
+
+	case bytes.HasPrefix(rest, []byte("/*")):
+		end := bytes.Index(rest[2:], []byte("*/"))
+		if end < 0 {
+			p.pos = len(p.data)
+			return string(rest)
+		}
+		p.pos += end + 4
+		return string(rest[:end+4])
+	}
+
+	return ""
+}
+
+// comments skips whitespace and collects the comments in it.
+func (p *jsoncParser) comments() []string {
+	var out []string
+	for {
+		p.space()
+		c := p.comment()
+		if c == "" {
+			return out
+		}
+		out = append(out, c)
+	}
+}
+
+func (p *jsoncParser) object() (*jsonObject, error) {
+	if p.eof() || p.data[p.pos] != '{' {
+		return nil, p.errorf("expected an object")
+	}
+	p.pos++
+
+	obj := &jsonObject{}
+	for {
+		pending := p.comments()
+		if p.eof() {
+			return nil, p.errorf("unexpected end of input")
+		}
+
+		if p.data[p.pos] == '}' {
+			p.pos++
+			obj.Tail = pending
+			return obj, nil
+		}
+
+		if p.data[p.pos] != '"' {
+			return nil, p.errorf("expected a key, found %q", p.data[p.pos])
+		}
+
+		rawKey, err := p.stringToken()
+		if err != nil {
+			return nil, err
+		}
+
+		var key string
+		if err := json.Unmarshal(rawKey, &key); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+
+		p.comments()
+		if p.eof() || p.data[p.pos] != ':' {
+			return nil, p.errorf("expected ':' after %q", key)
+		}
+		p.pos++
+		p.comments()
+
+		f := &jsonField{Key: key, Comments: pending}
+		if !p.eof() && p.data[p.pos] == '{' {
+			if f.Object, err = p.object(); err != nil {
+				return nil, err
+			}
+		} else {
+			start := p.pos
+			if f.Value, err = p.value(); err != nil {
+				return nil, err
+			}
+			f.Text = p.data[start:p.pos]
+		}
+		obj.Fields = append(obj.Fields, f)
+
+		// A comment on the same line, before or after the comma, belongs
+		// to this member.
+		f.Inline = p.inline()
+		if !p.eof() && p.data[p.pos] == ',' {
+			p.pos++
+			if c := p.inline(); c != "" {
+				f.Inline = c
+			}
+		}
+	}
+}
+
+// inline reads a comment that starts on the current line.
+func (p *jsoncParser) inline() string {
+	start := p.pos
+	for !p.eof() && (p.data[p.pos] == ' ' || p.data[p.pos] == '\t') {
+		p.pos++
+	}
+	if c := p.comment(); c != "" {
+		return c
+	}
+	p.pos = start
+	return ""
+}
+
+// value reads a non-object value and returns it as compact JSON.
+func (p *jsoncParser) value() (json.RawMessage, error) {
+	start := p.pos
+	depth := 0
+
+	for !p.eof() {
+		switch ch := p.data[p.pos]; {
+		case ch == '"':
+			if _, err := p.stringToken(); err != nil {
+				return nil, err
+			}
+			continue
+		case ch == '/' && p.comment() != "":
+			continue
+		case ch == '[' || ch == '{':
+			depth++
+		case ch == ']' || ch == '}':
+			if depth == 0 {
+				return p.compact(start)
+			}
+			depth--
+		case depth == 0 && strings.IndexByte(", \t\r\n/", ch) >= 0:
+			return p.compact(start)
+		}
+		p.pos++
+	}
+
+	return p.compact(start)
+}
+
+func (p *jsoncParser) compact(start int) (json.RawMessage, error) {
+	clean := stripJSONC(p.data[start:p.pos])
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, clean); err != nil {
+		return nil, p.errorf("invalid value %q: %v", bytes.TrimSpace(p.data[start:p.pos]), err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *jsoncParser) stringToken() ([]byte, error) {
+	start := p.pos
+	for p.pos++; !p.eof(); p.pos++ {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos++
+		case '"':
+			p.pos++
+			return p.data[start:p.pos], nil
+		}
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+// stripJSONC removes comments and trailing commas so data can be read by
+// encoding/json.
+func stripJSONC(data []byte) []byte {
+	var out []byte
+	p := &jsoncParser{data: data}
+
+	for !p.eof() {
+		switch ch := p.data[p.pos]; {
+		case ch == '"':
+			s, err := p.stringToken()
+			if err != nil {
+				return data
+			}
+			out = append(out, s...)
+		case ch == '/' && p.comment() != "":
+		case ch == ',':
+			p.pos++
+			rest := p.pos
+			p.comments()
+			if p.eof() || (p.data[p.pos] != ']' && p.data[p.pos] != '}') {
+				out = append(out, ',')
+			}
+			p.pos = rest
+		default:
+			out = append(out, ch)
+			p.pos++
+		}
+	}
+
+	return out
+}
+
+// writeJSONC prints obj one member per line with its comments, and every
+// non-object value on a single line, which is how VS Code settings are
+// usually laid out.
+func writeJSONC(buf *bytes.Buffer, obj *jsonObject, indent string, depth int) {
+	for _, c := range obj.Lead {
+		buf.WriteString(c + "\n")
+	}
+
+	defer func() {
+		for _, c := range obj.After {
+			buf.WriteString("\n" + c)
+		}
+	}()
+
+	if len(obj.Fields) == 0 && len(obj.Tail) == 0 {
+		buf.WriteString("{}")
+		return
+	}
+
+	pad := strings.Repeat(indent, depth+1)
+	buf.WriteString("{\n")
+
+	for i, f := range obj.Fields {
+		for _, c := range f.Comments {
+			buf.WriteString(pad + c + "\n")
+		}
+
+		key, _ := marshalNoEscape(f.Key)
+		buf.WriteString(pad)
+		buf.Write(key)
+		buf.WriteString(": ")
+
+		switch {
+		case f.Object != nil:
+			writeJSONC(buf, f.Object, indent, depth+1)
+		case f.Text != nil:
+			buf.Write(f.Text)
+		default:
+			buf.Write(f.Value)
+		}
+
+		if i < len(obj.Fields)-1 {
+			buf.WriteByte(',')
+		}
+		if f.Inline != "" {
+			buf.WriteString(" " + f.Inline)
+		}
+		buf.WriteByte('\n')
+	}
+
+	for _, c := range obj.Tail {
+		buf.WriteString(pad + c + "\n")
+	}
+
+	buf.WriteString(strings.Repeat(indent, depth) + "}")
+}
+
+func marshalNoEscape(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// detectIndent returns the indentation of the first indented line in data,
+// falling back to two spaces.
+func detectIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
@@ -0,0 +1,100 @@
+package setup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseJSONC(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]string // key to compact value
+	}{
+		{
+			name: "empty",
+			in:   "",
+			want: map[string]string{},
+		},
+		{
+			name: "line and block comments",
+			in: `// settings
+{
+  // font
+  "editor.fontSize": 14, // inline
+  /* block */ "editor.tabSize": 2
+}
+// after`,
+			want: map[string]string{"editor.fontSize": "14", "editor.tabSize": "2"},
+		},
+		{
+			name: "trailing commas",
+			in:   `{"a": [1, 2, ], "b": {"c": true, }, }`,
+			want: map[string]string{"a": "[1,2]", "b": `{"c":true}`},
+		},
+		{
+			name: "comment markers and escapes inside strings",
+			in:   `{"url": "http://example.com/*x*/", "quote": "say \"hi\" // not a comment", "path\\key": "C:\\dir"}`,
+			want: map[string]string{"url": `"http://example.com/*x*/"`, "quote": `"say \"hi\" // not a comment"`, `path\key`: `"C:\\dir"`},
+		},
+		{
+			name: "comments inside arrays",
+			in:   "{\"list\": [\n  1, // one\n  /* two */ 2,\n]}",
+			want: map[string]string{"list": "[1,2]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := parseJSONC([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseJSONC: %v", err)
+			}
+
+			if len(obj.Fields) != len(tt.want) {
+				t.Fatalf("got %d fields, want %d", len(obj.Fields), len(tt.want))
+			}
+			for _, f := range obj.Fields {
+				if got := string(f.raw()); got != tt.want[f.Key] {
+					t.Errorf("%s = %s, want %s", f.Key, got, tt.want[f.Key])
+				}
+			}
+		})
+	}
+}
+
+func TestParseJSONCErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`{"a": "open`, "unterminated string"},
+		{`{"a" 1}`, "expected ':'"},
+		{`{a: 1}`, "expected a key"},
+		{`{"a": 1`, "unexpected end of input"},
+		{`{"a": 1} {}`, "unexpected data after the object"},
+		{`[1, 2]`, "expected an object"},
+		{`{"a": nope}`, "invalid value"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseJSONC([]byte(tt.in))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseJSONC(%q) error = %v, want %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestParseJSONCKeepsComments(t *testing.T) {
+	in := "// top\n{\n  // above\n  \"a\": 1, // inline\n  \"b\": \"x\"\n  // tail\n}\n"
+
+	obj, err := parseJSONC([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, a := obj.field("a")
+	if strings.Join(obj.Lead, "|") != "// top" || strings.Join(a.Comments, "|") != "// above" || a.Inline != "// inline" || strings.Join(obj.Tail, "|") != "// tail" {
+		t.Errorf("comments not kept: lead %q, above %q, inline %q, tail %q", obj.Lead, a.Comments, a.Inline, obj.Tail)
+	}
+}
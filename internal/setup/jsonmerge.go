@@ -0,0 +1,225 @@
+package setup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+// keyMerge is stash's keys merged into a JSON or git config file: the new
+// content, what changed, and for JSON the keys stash owns in the result.
+type keyMerge struct {
+	Content []byte
+	Changes []string
+	Owned   []config.OwnedKey
+}
+
+func ownedPath() string {
+	return filepath.Join(utils.StashDir(), "owned.json")
+}
+
+// loadOwned returns the keys stash owns in each JSON file it merges into,
+// by the file's path.
+func loadOwned() map[string][]config.OwnedKey {
+	owned := map[string][]config.OwnedKey{}
+	if data, err := os.ReadFile(ownedPath()); err == nil {
+		_ = json.Unmarshal(data, &owned)
+	}
+	return owned
+}
+
+// saveOwned records the keys stash owns in the JSON file at path.
+func saveOwned(path string, keys []config.OwnedKey) error {
+	owned := loadOwned()
+	if _, ok := owned[path]; !ok && len(keys) == 0 {
+		return nil
+	}
+
+	if len(keys) == 0 {
+		delete(owned, path)
+	} else {
+		owned[path] = keys
+	}
+
+	data, err := json.MarshalIndent(owned, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(utils.StashDir(), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(ownedPath(), data, 0644)
+}
+
+// mergeJSONFile merges the JSON object in stash into the file at path,
+// which may not exist yet.
+func mergeJSONFile(path string, stash []byte) (*keyMerge, error) {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	m, err := mergeJSON(current, stash, loadOwned()[path])
+	if err != nil {
+		return nil, fmt.Errorf("merge %s: %w", utils.TildePath(path), err)
+	}
+
+	return m, nil
+}
+
+// mergeJSON sets every key of stash on current, merging nested objects key
+// by key and replacing anything else. Keys stash does not set keep their
+// place, comments and formatting; new keys are appended. Keys in owned that
+// stash no longer sets are removed, unless their value was changed by hand.
+// Both inputs may contain comments and trailing commas.
+func mergeJSON(current, stash []byte, owned []config.OwnedKey) (*keyMerge, error) {
+	base, err := parseJSONC(current)
+	if err != nil {
+		return nil, err
+	}
+
+	over, err := parseJSONC(stash)
+	if err != nil {
+		return nil, fmt.Errorf("stash settings: %w", err)
+	}
+
+	m := &keyMerge{}
+	prev := map[string]bool{}
+	for _, k := range owned {
+		prev[keyID(k.Key)] = true
+	}
+	set := map[string]bool{}
+
+	m.mergeFields(base, over, nil, prev, set)
+
+	for _, k := range owned {
+		if set[keyID(k.Key)] {
+			continue
+		}
+
+		f := lookupKey(base, k.Key)
+		if f == nil || !bytes.Equal(f.raw(), compactJSON(k.Value)) {
+			continue
+		}
+
+		removeKey(base, k.Key)
+		m.Changes = append(m.Changes, "removed "+keyName(k.Key))
+	}
+
+	if len(m.Changes) == 0 && len(bytes.TrimSpace(current)) > 0 {
+		m.Content = current
+		return m, nil
+	}
+
+	indent := detectIndent(stash)
+	if len(bytes.TrimSpace(current)) > 0 {
+		indent = detectIndent(current)
+	}
+
+	var buf bytes.Buffer
+	writeJSONC(&buf, base, indent, 0)
+	if len(bytes.TrimSpace(current)) == 0 || bytes.HasSuffix(current, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	m.Content = buf.Bytes()
+
+	return m, nil
+}
+
+func (m *keyMerge) mergeFields(base, over *jsonObject, path []string, prev, set map[string]bool) {
+	for _, f := range over.Fields {
+		p := append(slices.Clone(path), f.Key)
+		_, existing := base.field(f.Key)
+
+		switch {
+		case existing == nil:
+			base.Fields = append(base.Fields, f)
+			m.Changes = append(m.Changes, "added "+keyName(p))
+			m.own(p, f, func([]string) bool { return true }, set)
+
+		case existing.Object != nil && f.Object != nil:
+			m.mergeFields(existing.Object, f.Object, p, prev, set)
+
+		default:
+			if !bytes.Equal(existing.raw(), f.raw()) {
+				existing.Value, existing.Text, existing.Object = f.Value, nil, f.Object
+				m.Changes = append(m.Changes, "changed "+keyName(p))
+			}
+			m.own(p, f, func(k []string) bool { return prev[keyID(k)] }, set)
+		}
+	}
+}
+
+// own marks every leaf of f as set by stash and records the ones owned
+// decides stash owns.
+func (m *keyMerge) own(path []string, f *jsonField, owned func([]string) bool, set map[string]bool) {
+	if f.Object != nil && len(f.Object.Fields) > 0 {
+		for _, child := range f.Object.Fields {
+			m.own(append(slices.Clone(path), child.Key), child, owned, set)
+		}
+		return
+	}
+
+	set[keyID(path)] = true
+	if owned(path) {
+		m.Owned = append(m.Owned, config.OwnedKey{Key: path, Value: f.raw()})
+	}
+}
+
+func lookupKey(obj *jsonObject, path []string) *jsonField {
+	_, f := obj.field(path[0])
+	if f == nil || len(path) == 1 {
+		return f
+	}
+	if f.Object == nil {
+		return nil
+	}
+	return lookupKey(f.Object, path[1:])
+}
+
+// removeKey deletes the key at path, along with any object the removal
+// leaves empty.
+func removeKey(obj *jsonObject, path []string) {
+	i, f := obj.field(path[0])
+	if f == nil {
+		return
+	}
+
+	if len(path) > 1 {
+		if f.Object == nil {
+			return
+		}
+		removeKey(f.Object, path[1:])
+		if len(f.Object.Fields) > 0 || len(f.Object.Tail) > 0 {
+			return
+		}
+	}
+
+	obj.Fields = slices.Delete(obj.Fields, i, i+1)
+}
+
+func compactJSON(data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+func keyID(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+func keyName(path []string) string {
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,124 @@
+package setup
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/huffmanks/stash/internal/config"
+)
+
+func owned(pairs ...string) []config.OwnedKey {
+	var keys []config.OwnedKey
+	for i := 0; i < len(pairs); i += 2 {
+		keys = append(keys, config.OwnedKey{Key: []string{pairs[i]}, Value: json.RawMessage(pairs[i+1])})
+	}
+	return keys
+}
+
+func TestMergeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		stash   string
+		owned   []config.OwnedKey
+		want    string
+		changes []string
+	}{
+		{
+			name:    "new file",
+			current: "",
+			stash:   `{"a": 1}`,
+			want:    "{\n  \"a\": 1\n}\n",
+			changes: []string{"added a"},
+		},
+		{
+			name:    "keeps comments, order and trailing commas of user keys",
+			current: "{\n    // mine\n    \"user\": [1, 2,], // inline\n    \"a\": 0,\n}\n",
+			stash:   `{"a": 1, "b": "x"}`,
+			want:    "{\n    // mine\n    \"user\": [1, 2,], // inline\n    \"a\": 1,\n    \"b\": \"x\"\n}\n",
+			changes: []string{"changed a", "added b"},
+		},
+		{
+			name:    "merges nested objects key by key",
+			current: `{"[go]": {"editor.tabSize": 8, "mine": true}}`,
+			stash:   `{"[go]": {"editor.tabSize": 4}}`,
+			want:    "{\n  \"[go]\": {\n    \"editor.tabSize\": 4,\n    \"mine\": true\n  }\n}",
+			changes: []string{"changed [go].editor.tabSize"},
+		},
+		{
+			name:    "escaped strings round trip",
+			current: `{"path": "C:\\dir \"x\" <b>"}`,
+			stash:   `{"a": "<tag> & \"q\""}`,
+			want:    "{\n  \"path\": \"C:\\\\dir \\\"x\\\" <b>\",\n  \"a\": \"<tag> & \\\"q\\\"\"\n}",
+			changes: []string{"added a"},
+		},
+		{
+			name:    "removes owned keys stash no longer sets",
+			current: "{\n  \"old\": true,\n  \"a\": 1\n}\n",
+			stash:   `{"a": 1}`,
+			owned:   owned("old", "true", "a", "1"),
+			want:    "{\n  \"a\": 1\n}\n",
+			changes: []string{"removed old"},
+		},
+		{
+			name:    "keeps owned keys the user edited",
+			current: "{\n  \"old\": false,\n  \"a\": 1\n}\n",
+			stash:   `{"a": 1}`,
+			owned:   owned("old", "true", "a", "1"),
+			want:    "{\n  \"old\": false,\n  \"a\": 1\n}\n",
+		},
+		{
+			name:    "unchanged file is left byte for byte",
+			current: "{ \"a\":1 }",
+			stash:   `{"a": 1}`,
+			want:    "{ \"a\":1 }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := mergeJSON([]byte(tt.current), []byte(tt.stash), tt.owned)
+			if err != nil {
+				t.Fatalf("mergeJSON: %v", err)
+			}
+			if string(m.Content) != tt.want {
+				t.Errorf("content\n got: %q\nwant: %q", m.Content, tt.want)
+			}
+			if !slices.Equal(m.Changes, tt.changes) {
+				t.Errorf("changes = %q, want %q", m.Changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestMergeJSONOwned(t *testing.T) {
+	// a is new so stash owns it; user was already there with stash's
+	// value, so it stays the user's.
+	m, err := mergeJSON([]byte(`{"user": 1}`), []byte(`{"a": {"b": 2}, "user": 1}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Owned) != 1 || keyName(m.Owned[0].Key) != "a.b" || string(m.Owned[0].Value) != "2" {
+		t.Errorf("owned = %+v, want only a.b = 2", m.Owned)
+	}
+
+	// Once owned, a later merge keeps owning it.
+	m, err = mergeJSON(m.Content, []byte(`{"a": {"b": 3}}`), m.Owned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Owned) != 1 || string(m.Owned[0].Value) != "3" {
+		t.Errorf("owned after change = %+v, want a.b = 3", m.Owned)
+	}
+}
+
+func TestMergeJSONInvalid(t *testing.T) {
+	if _, err := mergeJSON([]byte(`{"a": }`), []byte(`{}`), nil); err == nil {
+		t.Error("invalid current file: want an error")
+	}
+	if _, err := mergeJSON([]byte(`{}`), []byte(`{"a"}`), nil); err == nil {
+		t.Error("invalid stash settings: want an error")
+	}
+}
@@ -0,0 +1,131 @@
+package setup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+const (
+	managedBegin = "# >>> stash managed >>>"
+	managedEnd   = "# <<< stash managed <<<"
+)
+
+// errUnterminatedBlock means a begin marker has no end marker, so stash
+// cannot tell where its block stops and the user's lines start.
+var errUnterminatedBlock = errors.New("stash managed block has no end marker")
+
+// managedContent returns what should be written to ~/<file> for rendered
+// content. In managed mode that is the current file with only the stash
+// block replaced, plus a note for every problem with the old block that was
+// repaired along the way.
+func managedContent(c *config.Config, file string, rendered []byte) ([]byte, []string, error) {
+	if !managedFile(c, file) {
+		return rendered, nil, nil
+	}
+
+	current, _ := os.ReadFile(utils.TargetPath(file))
+	return mergeManaged(current, rendered)
+}
+
+// managedFile reports whether file gets a stash block in managed mode.
+// Files stash merges key by key never do.
+func managedFile(c *config.Config, file string) bool {
+	return c.Managed && !mergeTarget(c, file)
+}
+
+// mergeTarget reports whether stash merges its keys into file instead of
+// writing the whole file: always for the VS Code settings, which are JSON
+// and have no comments to mark a block with, and for .gitconfig when
+// git_merge is set.
+func mergeTarget(c *config.Config, file string) bool {
+	return file == config.VSCodeSettings || (file == ".gitconfig" && c.GitMerge)
+}
+
+// mergeManaged puts block between the stash markers in current, leaving
+// everything outside the markers alone. Without markers the block is
+// appended. A stray end marker is dropped and every block after the first
+// is removed so only one copy remains. A begin marker with no end fails
+// with errUnterminatedBlock rather than guess which lines after it are the
+// user's.
+func mergeManaged(current, block []byte) ([]byte, []string, error) {
+	lines := strings.Split(string(current), "\n")
+	if len(current) == 0 {
+		lines = nil
+	}
+
+	var out []string
+	var repairs []string
+	inserted := false
+	inBlock := false
+
+	insert := func() {
+		if !inserted {
+			out = append(out, managedBlock(block)...)
+			inserted = true
+		}
+	}
+
+	begin := 0
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case managedBegin:
+			if inBlock {
+				return nil, nil, fmt.Errorf("%w at line %d", errUnterminatedBlock, begin)
+			}
+			begin = i + 1
+			if inserted {
+				repairs = append(repairs, "duplicate block removed")
+			}
+			insert()
+			inBlock = true
+			continue
+
+		case managedEnd:
+			if !inBlock {
+				repairs = append(repairs, "stray end marker removed")
+				insert()
+			}
+			inBlock = false
+			continue
+		}
+
+		if !inBlock {
+			out = append(out, line)
+		}
+	}
+
+	if inBlock {
+		return nil, nil, fmt.Errorf("%w at line %d", errUnterminatedBlock, begin)
+	}
+
+	if !inserted {
+		// Drop the empty string left by the trailing newline so the block
+		// follows the existing content after exactly one blank line.
+		for len(out) > 0 && out[len(out)-1] == "" {
+			out = out[:len(out)-1]
+		}
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		insert()
+		out = append(out, "")
+	}
+
+	return []byte(strings.Join(out, "\n")), repairs, nil
+}
+
+func managedBlock(block []byte) []string {
+	body := string(bytes.TrimRight(block, "\n"))
+
+	lines := []string{managedBegin}
+	if body != "" {
+		lines = append(lines, strings.Split(body, "\n")...)
+	}
+	return append(lines, managedEnd)
+}
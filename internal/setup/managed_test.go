@@ -0,0 +1,84 @@
+package setup
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMergeManaged(t *testing.T) {
+	block := "export A=1\n"
+
+	tests := []struct {
+		name    string
+		current string
+		want    string
+		repairs []string
+	}{
+		{
+			name:    "empty file",
+			current: "",
+			want:    "# >>> stash managed >>>\nexport A=1\n# <<< stash managed <<<\n",
+		},
+		{
+			name:    "appended after user content",
+			current: "alias a=b\n\n\n",
+			want:    "alias a=b\n\n# >>> stash managed >>>\nexport A=1\n# <<< stash managed <<<\n",
+		},
+		{
+			name:    "replaces the block in place",
+			current: "before\n# >>> stash managed >>>\nold\n# <<< stash managed <<<\nafter\n",
+			want:    "before\n# >>> stash managed >>>\nexport A=1\n# <<< stash managed <<<\nafter\n",
+		},
+		{
+			name:    "indented markers",
+			current: "  # >>> stash managed >>>\nold\n  # <<< stash managed <<<  \n",
+			want:    "# >>> stash managed >>>\nexport A=1\n# <<< stash managed <<<\n",
+		},
+		{
+			name:    "duplicate block removed",
+			current: "# >>> stash managed >>>\nold\n# <<< stash managed <<<\nmine\n# >>> stash managed >>>\nolder\n# <<< stash managed <<<\n",
+			want:    "# >>> stash managed >>>\nexport A=1\n# <<< stash managed <<<\nmine\n",
+			repairs: []string{"duplicate block removed"},
+		},
+		{
+			name:    "stray end marker removed",
+			current: "mine\n# <<< stash managed <<<\nmore\n",
+			want:    "mine\n# >>> stash managed >>>\nexport A=1\n# <<< stash managed <<<\nmore\n",
+			repairs: []string{"stray end marker removed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, repairs, err := mergeManaged([]byte(tt.current), []byte(block))
+			if err != nil {
+				t.Fatalf("mergeManaged: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("content\n got: %q\nwant: %q", got, tt.want)
+			}
+			if !slices.Equal(repairs, tt.repairs) {
+				t.Errorf("repairs = %q, want %q", repairs, tt.repairs)
+			}
+
+			// Merging again changes nothing.
+			again, _, err := mergeManaged(got, []byte(block))
+			if err != nil || string(again) != string(got) {
+				t.Errorf("second merge = %q, %v, want it unchanged", again, err)
+			}
+		})
+	}
+}
+
+func TestMergeManagedUnterminated(t *testing.T) {
+	for _, current := range []string{
+		"mine\n# >>> stash managed >>>\nold\nalias keep=me\n",
+		"# >>> stash managed >>>\nold\n# >>> stash managed >>>\nold\n# <<< stash managed <<<\n",
+	} {
+		_, _, err := mergeManaged([]byte(current), []byte("export A=1\n"))
+		if !errors.Is(err, errUnterminatedBlock) {
+			t.Errorf("mergeManaged(%q) error = %v, want errUnterminatedBlock", current, err)
+		}
+	}
+}
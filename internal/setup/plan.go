@@ -0,0 +1,527 @@
+package setup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/huffmanks/stash/internal/catalog"
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// BuildPlan decides everything an operation will do without doing any of
+// it. Executing the returned plan is the only way setup changes the system.
+func BuildPlan(c *config.Config, goos, arch string) (*config.Plan, error) {
+	plan := &config.Plan{
+		Operation: c.Operation,
+		OS:        goos,
+		Arch:      arch,
+		Config:    c,
+		Steps:     []config.Step{},
+	}
+
+	var err error
+
+	switch c.Operation {
+	case "install":
+		plan.Steps, err = planInstall(c, goos, arch)
+	case "configure":
+		plan.Steps, err = planConfigure(c, goos, arch)
+	case "delete":
+		plan.Steps, err = planDelete(c, time.Now())
+	case "restore":
+		plan.Steps, err = planRestore(c.Restore, c.RestoreAt)
+	default:
+		err = fmt.Errorf("unknown operation: %q", c.Operation)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+func planInstall(c *config.Config, goos, arch string) ([]config.Step, error) {
+	var steps []config.Step
+
+	if goos == "darwin" {
+		prereqs, err := planMacOSPrereqs(c.PackageManager)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, prereqs...)
+	}
+
+	cat, err := catalog.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []catalog.Package
+	seen := map[string]bool{}
+
+	var add func(name string, required bool) error
+	add = func(name string, required bool) error {
+		if seen[name] {
+			return nil
+		}
+
+		pkg, ok := cat.Get(name)
+		if !ok {
+			return fmt.Errorf("unknown package %q, add it to %s", name, catalog.UserPath())
+		}
+
+		if !pkg.SupportsOS(goos) {
+			if required {
+				return nil
+			}
+			return fmt.Errorf("%s is not supported on %s", name, goos)
+		}
+
+		seen[name] = true
+		pkgs = append(pkgs, pkg)
+
+		for _, dep := range pkg.Requires {
+			if err := add(dep, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, name := range c.SelectedPkgs {
+		if err := add(name, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pkg := range pkgs {
+		action := "install"
+
+		if status := probePackage(c.PackageManager, pkg, goos); status.Installed {
+			action = c.ActionFor(pkg.Name)
+
+			if action == "skip" {
+				steps = append(steps, config.Step{Kind: config.StepSkip, Package: pkg.Name, Reason: installedReason(status)})
+				continue
+			}
+		}
+
+		pkgSteps, err := planPackage(c.PackageManager, pkg, action, goos, arch)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, pkgSteps...)
+	}
+
+	return steps, nil
+}
+
+func installedReason(status config.PkgStatus) string {
+	if status.Version != "" {
+		return fmt.Sprintf("already installed (%s)", status.Version)
+	}
+	return "already installed"
+}
+
+func planConfigure(c *config.Config, goos, arch string) ([]config.Step, error) {
+	var steps []config.Step
+	now := time.Now()
+
+	for _, file := range buildTargets(c) {
+		content, includes, skip, err := renderTarget(c, file, goos, arch)
+		if err != nil {
+			return nil, err
+		}
+
+		if skip != "" {
+			steps = append(steps, config.Step{Kind: config.StepSkip, File: file, Reason: skip})
+			continue
+		}
+
+		content, merge, repairs, err := targetContent(c, file, content)
+		if errors.Is(err, errUnterminatedBlock) {
+			steps = append(steps, config.Step{Kind: config.StepSkip, File: file, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		targetSteps := fileSteps(file, content, includes, now)
+		write := &targetSteps[len(targetSteps)-1]
+
+		switch {
+		case merge != nil:
+			write.Action = "merge"
+			write.Changes = merge.Changes
+			write.Owned = merge.Owned
+		case managedFile(c, file):
+			write.Action = "managed"
+			write.Reason = strings.Join(repairs, ", ")
+		}
+
+		steps = append(steps, targetSteps...)
+	}
+
+	return steps, nil
+}
+
+// buildTargets lists the files c builds in build order: the selected
+// BuildTargets, with the git identity files right after .gitconfig.
+func buildTargets(c *config.Config) []string {
+	var files []string
+
+	for _, file := range config.BuildTargets {
+		if !slices.Contains(c.BuildFiles, file) {
+			continue
+		}
+
+		files = append(files, file)
+
+		if file == ".gitconfig" {
+			for _, id := range c.GitIdentities {
+				files = append(files, config.IdentityFile(id.Name))
+			}
+		}
+	}
+
+	return files
+}
+
+// renderTarget produces the content stash would write for one build file.
+// A non-empty skip reason means there is nothing to write on this platform.
+func renderTarget(c *config.Config, file, goos, arch string) (content []byte, includes []string, skip string, err error) {
+	if shell, ok := config.RCShell(file); ok {
+		content, includes, err = renderShellRC(c, shell, goos, arch)
+		return content, includes, "", err
+	}
+
+	if shell, ok := config.ProfileShell(file); ok {
+		var source string
+		if content, source, err = findProfile(c, shell, goos, arch); err != nil {
+			return nil, nil, "", err
+		}
+		if content == nil {
+			return nil, nil, fmt.Sprintf("No %s found in search paths", file), nil
+		}
+		return content, []string{source}, "", nil
+	}
+
+	if id, ok := c.IdentityFor(file); ok {
+		if content, err = renderIdentity(id); err != nil {
+			return nil, nil, "", fmt.Errorf("render %s: %w", file, err)
+		}
+		return content, nil, "", nil
+	}
+
+	switch file {
+	case ".gitignore":
+		if content, includes, err = renderGitIgnore(c); err != nil {
+			return nil, nil, "", fmt.Errorf("render .gitignore: %w", err)
+		}
+		if content == nil {
+			return nil, nil, "No .gitignore fragments selected", nil
+		}
+	case ".gitconfig":
+		if content, err = renderGitConfig(c); err != nil {
+			return nil, nil, "", fmt.Errorf("render .gitconfig: %w", err)
+		}
+	case config.VSCodeSettings:
+		var source string
+		if content, source, err = readVSCodeSettings(c); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Sprintf("No VS Code settings found at: %s", source), nil
+		} else if err != nil {
+			return nil, nil, "", err
+		}
+		includes = []string{source}
+	default:
+		return nil, nil, "", fmt.Errorf("unknown build file: %q", file)
+	}
+
+	return content, includes, "", nil
+}
+
+// targetContent turns the rendered content of file into what is written to
+// its target: merge targets get stash's keys merged into the current file,
+// and in managed mode everything else only has its stash block replaced.
+func targetContent(c *config.Config, file string, rendered []byte) ([]byte, *keyMerge, []string, error) {
+	if mergeTarget(c, file) {
+		var merge *keyMerge
+		var err error
+
+		if file == ".gitconfig" {
+			merge, err = mergeGitConfigFile(utils.TargetPath(file), rendered)
+		} else {
+			merge, err = mergeJSONFile(utils.TargetPath(file), rendered)
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return merge.Content, merge, nil, nil
+	}
+
+	content, repairs, err := managedContent(c, file, rendered)
+	return content, nil, repairs, err
+}
+
+// fileSteps writes content to the target of file, moving any existing file aside
+// first.
+func fileSteps(file string, content []byte, includes []string, now time.Time) []config.Step {
+	var steps []config.Step
+	target := utils.TargetPath(file)
+
+	if _, err := os.Stat(target); err == nil {
+		steps = append(steps, config.Step{Kind: config.StepBackup, File: file, Path: target, Source: utils.BackupPath(file, now)})
+	}
+
+	return append(steps, config.Step{
+		Kind:     config.StepWrite,
+		File:     file,
+		Path:     target,
+		Hash:     hashContent(content),
+		Includes: includes,
+		Content:  content,
+	})
+}
+
+// planDelete removes the backups the retention policy in c does not keep,
+// and records the kept ones so plans and dry runs show both. The backups a
+// full uninstall restores from are always kept.
+func planDelete(c *config.Config, now time.Time) ([]config.Step, error) {
+	backups, err := utils.ListBackups()
+	if err != nil {
+		return nil, fmt.Errorf("glob backups: %w", err)
+	}
+
+	decisions, err := utils.ApplyRetention(backups, c, now)
+	if err != nil {
+		return nil, err
+	}
+
+	originals := recordedBackups()
+
+	steps := []config.Step{}
+	for _, d := range decisions {
+		if originals[filepath.Clean(d.Path)] {
+			d.Keep = true
+			d.Reason = "original before stash"
+		}
+
+		kind := config.StepDelete
+		if d.Keep {
+			kind = config.StepKeep
+		}
+		steps = append(steps, config.Step{Kind: kind, File: d.File, Path: d.Path, Reason: d.Reason})
+	}
+
+	return steps, nil
+}
+
+// planRestore puts a backup of file back in place, first backing up the
+// current file so the restore itself can be undone.
+func planRestore(file, at string) ([]config.Step, error) {
+	b, err := utils.FindBackup(file, at)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(b.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []config.Step
+	target := utils.TargetPath(file)
+
+	if _, err := os.Stat(target); err == nil {
+		steps = append(steps, config.Step{Kind: config.StepBackup, File: file, Path: target, Source: utils.BackupPath(file, time.Now())})
+	}
+
+	return append(steps, config.Step{Kind: config.StepRestore, File: file, Path: target, Source: b.Path, Hash: hashContent(data)}), nil
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint identifies a step for comparing a saved plan with a fresh one.
+// Backup destinations are left out since they embed the planning time.
+func fingerprint(s config.Step) string {
+	return strings.Join([]string{string(s.Kind), s.Package, s.File, s.Path, s.Command, s.Hash}, "\x00")
+}
+
+func LoadPlan(path string) (*config.Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan config.Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if plan.Config == nil {
+		return nil, fmt.Errorf("parse %s: plan has no config", path)
+	}
+
+	return &plan, nil
+}
+
+// VerifyPlan rebuilds a saved plan from its config and fails when the
+// result differs, so a reviewed plan is never applied against a machine or
+// asset set that has since changed. The rendered file contents are carried
+// over from the rebuild since they are not stored in the plan, and so are
+// the owned JSON keys, which follow from them.
+func VerifyPlan(saved *config.Plan, goos, arch string) error {
+	if saved.OS != goos || saved.Arch != arch {
+		return fmt.Errorf("plan was made for %s/%s, this machine is %s/%s", saved.OS, saved.Arch, goos, arch)
+	}
+
+	fresh, err := BuildPlan(saved.Config, goos, arch)
+	if err != nil {
+		return err
+	}
+
+	if len(fresh.Steps) != len(saved.Steps) {
+		return fmt.Errorf("plan is stale: expected %d steps, now %d", len(saved.Steps), len(fresh.Steps))
+	}
+
+	for i := range saved.Steps {
+		if fingerprint(saved.Steps[i]) != fingerprint(fresh.Steps[i]) {
+			return fmt.Errorf("plan is stale: step %d (%s) changed", i+1, describeStep(saved.Steps[i]))
+		}
+		saved.Steps[i].Content = fresh.Steps[i].Content
+		saved.Steps[i].Owned = fresh.Steps[i].Owned
+	}
+
+	return nil
+}
+
+func describeStep(s config.Step) string {
+	switch s.Kind {
+	case config.StepInstall:
+		return fmt.Sprintf("%s %s via %s", stepAction(s), s.Package, s.Manager)
+	case config.StepScript:
+		return fmt.Sprintf("%s %s via script", stepAction(s), s.Package)
+	case config.StepHook:
+		return fmt.Sprintf("post-install hook for %s", s.Package)
+	case config.StepClone:
+		if s.Action == "reinstall" {
+			return fmt.Sprintf("re-clone %s into %s", s.Package, utils.TildePath(filepath.Dir(s.Path)))
+		}
+		return fmt.Sprintf("clone %s into %s", s.Package, utils.TildePath(filepath.Dir(s.Path)))
+	case config.StepSkip:
+		return fmt.Sprintf("skip %s%s", s.Package, s.File)
+	case config.StepBackup:
+		return fmt.Sprintf("back up %s to %s", utils.TildePath(s.Path), utils.TildePath(s.Source))
+	case config.StepWrite:
+		switch s.Action {
+		case "managed":
+			return fmt.Sprintf("update stash block in %s", utils.TildePath(s.Path))
+		case "merge":
+			return fmt.Sprintf("merge settings into %s", utils.TildePath(s.Path))
+		}
+		return fmt.Sprintf("write %s", utils.TildePath(s.Path))
+	case config.StepDelete:
+		return fmt.Sprintf("delete %s", utils.TildePath(s.Path))
+	case config.StepKeep:
+		return fmt.Sprintf("keep %s", utils.TildePath(s.Path))
+	case config.StepRestore:
+		return fmt.Sprintf("restore %s", utils.TildePath(s.Path))
+	}
+
+	return string(s.Kind)
+}
+
+func stepAction(s config.Step) string {
+	if s.Action != "" {
+		return s.Action
+	}
+	return "install"
+}
+
+func stepDetail(s config.Step) string {
+	switch s.Kind {
+	case config.StepInstall, config.StepScript, config.StepHook:
+		return s.Command
+	case config.StepClone:
+		return s.Source
+	case config.StepSkip, config.StepDelete, config.StepKeep:
+		return s.Reason
+	case config.StepWrite:
+		if s.Action == "merge" {
+			return fmt.Sprintf("sha256:%s (%s)", s.Hash[:12], changeSummary(s.Changes))
+		}
+		if s.Reason != "" {
+			return fmt.Sprintf("sha256:%s (repaired: %s)", s.Hash[:12], s.Reason)
+		}
+		return "sha256:" + s.Hash[:12]
+	case config.StepRestore:
+		return filepath.Base(s.Source)
+	}
+
+	return ""
+}
+
+// changeSummary counts the keys a merge adds, changes and removes.
+func changeSummary(changes []string) string {
+	counts := map[string]int{}
+	for _, c := range changes {
+		verb, _, _ := strings.Cut(c, " ")
+		counts[verb]++
+	}
+	return fmt.Sprintf("%d added, %d changed, %d removed", counts["added"], counts["changed"], counts["removed"])
+}
+
+// RenderPlan prints the plan as a table, or as indented JSON when asJSON is
+// set.
+func RenderPlan(plan *config.Plan, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(plan)
+	}
+
+	if len(plan.Steps) == 0 {
+		tap.Message(utils.Style("✨ [EMPTY]: Nothing to do.", "orange"))
+		return nil
+	}
+
+	headers := []string{"#", "Step", "Details"}
+	rows := make([][]string, len(plan.Steps))
+
+	for i, s := range plan.Steps {
+		detail := stepDetail(s)
+		if len(detail) > 60 {
+			detail = detail[:57] + "..."
+		}
+		rows[i] = []string{fmt.Sprint(i + 1), describeStep(s), utils.Style(detail, "dim")}
+	}
+
+	tap.Table(headers, rows, tap.TableOptions{
+		ShowBorders:   true,
+		IncludePrefix: true,
+		MaxWidth:      120,
+		HeaderStyle:   tap.TableStyleBold,
+		HeaderColor:   tap.TableColorGreen,
+	})
+
+	return nil
+}
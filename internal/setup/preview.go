@@ -0,0 +1,105 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// previewFile shows how the write or restore step s would change its
+// target, listing the keys a merge sets or removes, and, when running
+// interactively, asks whether to accept, skip or edit the new content. It
+// returns the content to write, or false when the file should be left
+// alone. Dry runs only print the diff.
+func previewFile(s config.Step, dryRun bool) ([]byte, bool, error) {
+	content := s.Content
+	if s.Kind == config.StepRestore {
+		data, err := os.ReadFile(s.Source)
+		if err != nil {
+			return nil, false, err
+		}
+		content = data
+	}
+
+	current, err := os.ReadFile(s.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+
+	oldName := utils.TildePath(s.Path)
+	if current == nil {
+		oldName = "/dev/null"
+	}
+
+	if len(s.Changes) > 0 {
+		tap.Message(fmt.Sprintf("🔑 [KEYS]: %s, %s\n\n%s", s.File, changeSummary(s.Changes), formatChanges(s.Changes)))
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	for {
+		diff := utils.UnifiedDiff(oldName, utils.TildePath(s.Path), current, content)
+		if diff == "" {
+			tap.Message(fmt.Sprintf("💤 [UNCHANGED]: %s", s.File))
+			time.Sleep(time.Millisecond * 100)
+			return nil, false, nil
+		}
+
+		colored := utils.ColorDiff(diff)
+		if dryRun || !utils.Interactive || !utils.Page(colored) {
+			tap.Message(fmt.Sprintf("🔍 [DIFF]: %s\n\n%s", s.File, colored))
+		}
+
+		if dryRun || !utils.Interactive {
+			return content, true, nil
+		}
+
+		choice := tap.Select(context.Background(), tap.SelectOptions[string]{
+			Message: fmt.Sprintf("Apply these changes to %s?", s.File),
+			Options: []tap.SelectOption[string]{
+				{Value: "accept", Label: "Accept", Hint: "Back up the current file and write the new one"},
+				{Value: "skip", Label: "Skip", Hint: "Leave the current file as is"},
+				{Value: "edit", Label: "Edit", Hint: "Open the new content in $EDITOR first"},
+			},
+		})
+
+		switch choice {
+		case "accept":
+			return content, true, nil
+		case "skip":
+			tap.Message(utils.Style(fmt.Sprintf("⏭️  [SKIPPED]: %s left unchanged", s.File), "orange"))
+			time.Sleep(time.Millisecond * 100)
+			return nil, false, nil
+		}
+
+		edited, err := utils.EditContent(s.File, content)
+		if err != nil {
+			tap.Message(utils.Style(fmt.Sprintf("⚠️  [WARNING]: %v", err), "orange"))
+			continue
+		}
+		content = edited
+	}
+}
+
+// formatChanges lists the keys a merge step sets or removes, one per line.
+func formatChanges(changes []string) string {
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		verb, key, _ := strings.Cut(c, " ")
+		switch verb {
+		case "added":
+			lines[i] = utils.Style("     + "+key, "green")
+		case "changed":
+			lines[i] = utils.Style("     ~ "+key, "orange")
+		default:
+			lines[i] = utils.Style("     - "+key, "red")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
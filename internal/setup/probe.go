@@ -0,0 +1,166 @@
+package setup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/huffmanks/stash/internal/catalog"
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+// ProbePackages reports which of the named packages are already present.
+// Names missing from the catalog are reported as not installed.
+func ProbePackages(pm string, names []string, goos string) []config.PkgStatus {
+	cat, _ := catalog.Load()
+
+	statuses := make([]config.PkgStatus, 0, len(names))
+	for _, name := range names {
+		pkg, ok := cat.Get(name)
+		if !ok {
+			statuses = append(statuses, config.PkgStatus{Name: name})
+			continue
+		}
+		statuses = append(statuses, probePackage(pm, pkg, goos))
+	}
+
+	return statuses
+}
+
+// probePackage checks, in order: the clone directory for plugins, the
+// package manager's database for packages it installs, then the commands
+// and paths listed in the catalog entry.
+func probePackage(pm string, pkg catalog.Package, goos string) config.PkgStatus {
+	status := config.PkgStatus{Name: pkg.Name}
+	method, custom := pkg.MethodFor(goos)
+
+	if custom && method.Clone != "" {
+		home, _ := os.UserHomeDir()
+		dir := filepath.Join(home, ".zsh", pkg.Name)
+		if _, err := os.Stat(dir); err == nil {
+			status.Installed = true
+			status.Source = utils.TildePath(dir)
+			status.Version, _ = probeOutput("git", "-C", dir, "rev-parse", "--short", "HEAD")
+		}
+		return status
+	}
+
+	if !custom {
+		if version, ok := pmQuery(pm, pkg.NameFor(pm)); ok {
+			status.Installed = true
+			status.Version = version
+			status.Source = pm
+			return status
+		}
+	}
+
+	bins := pkg.Bins
+	if len(bins) == 0 {
+		bins = []string{pkg.Name}
+	}
+
+	for _, bin := range bins {
+		if binPath, err := exec.LookPath(bin); err == nil {
+			status.Installed = true
+			status.Source = binPath
+			if out, ok := probeOutput(binPath, "--version"); ok {
+				status.Version = firstLine(out)
+			}
+			return status
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, p := range pkg.Paths {
+		p = strings.Replace(p, "~", home, 1)
+		if _, err := os.Stat(p); err == nil {
+			status.Installed = true
+			status.Source = utils.TildePath(p)
+			return status
+		}
+	}
+
+	return status
+}
+
+// pmQuery asks the package manager whether name is installed and returns
+// its version.
+func pmQuery(pm, name string) (string, bool) {
+	var out string
+	var ok bool
+
+	switch pm {
+	case "apt":
+		out, ok = probeOutput("dpkg-query", "-W", "-f=${Status} ${Version}", name)
+		if !ok || !strings.HasPrefix(out, "install ok installed") {
+			return "", false
+		}
+		return strings.TrimSpace(strings.TrimPrefix(out, "install ok installed")), true
+	case "dnf", "zypper":
+		out, ok = probeOutput("rpm", "-q", "--qf", "%{VERSION}", name)
+	case "pacman":
+		out, ok = probeOutput("pacman", "-Q", name)
+		out = lastField(out)
+	case "homebrew":
+		out, ok = probeOutput("brew", "list", "--versions", strings.TrimPrefix(name, "--cask "))
+		out = lastField(out)
+	case "macports":
+		out, ok = probeOutput("port", "-q", "installed", name)
+		if !ok || !strings.Contains(out, "(active)") {
+			return "", false
+		}
+		for _, f := range strings.Fields(out) {
+			if strings.HasPrefix(f, "@") {
+				out = strings.TrimPrefix(f, "@")
+			}
+		}
+	case "apk":
+		out, ok = probeOutput("apk", "info", "-e", "-v", name)
+		out = strings.TrimPrefix(out, name+"-")
+	case "xbps":
+		out, ok = probeOutput("xbps-query", "-p", "pkgver", name)
+		out = strings.TrimPrefix(out, name+"-")
+	case "nix":
+		out, ok = probeOutput("nix-env", "-q", name)
+		out = strings.TrimPrefix(out, name+"-")
+	}
+
+	if !ok || out == "" {
+		return "", false
+	}
+
+	return out, true
+}
+
+func probeOutput(name string, args ...string) (string, bool) {
+	if !utils.CommandExists(name) && !filepath.IsAbs(name) {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(string(out)), true
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(line)
+}
+
+func lastField(s string) string {
+	fields := strings.Fields(firstLine(s))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
@@ -0,0 +1,170 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// projectFile is a file `stash init-project` writes into a project, and
+// where it comes from in the dotfiles.
+type projectFile struct {
+	Name   string
+	Source string
+	Hint   string
+}
+
+var projectFiles = []projectFile{
+	{Name: ".vscode/settings.json", Source: ".vscode/workspace.settings.json", Hint: "Merged into existing settings"},
+	{Name: "biome.json", Source: "biome.json", Hint: "Biome formatter and linter"},
+	{Name: ".biomeignore", Source: ".biomeignore"},
+	{Name: ".prettierrc", Source: ".prettierrc", Hint: "Prettier with import sorting and tailwind"},
+	{Name: ".prettierignore", Source: ".prettierignore"},
+	{Name: ".dockerignore", Source: ".dockerignore"},
+	{Name: ".pnpmfile.cjs", Source: ".pnpmfile.cjs", Hint: "esbuild pin for macOS Big Sur"},
+}
+
+// ProjectFileNames lists the files `stash init-project` can write.
+func ProjectFileNames() []string {
+	names := make([]string, len(projectFiles))
+	for i, f := range projectFiles {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// HandleInitProject implements `stash init-project [dir]`: it writes the
+// selected project files into dir, showing a diff for each one that already
+// exists and backing it up before it is replaced. When files is empty the
+// user picks them from a list.
+func HandleInitProject(banner, dir string, files []string, dryRun bool) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stash init-project: %v\n", err)
+		os.Exit(2)
+	}
+
+	for _, f := range files {
+		if !slices.Contains(ProjectFileNames(), f) {
+			fmt.Fprintf(os.Stderr, "stash init-project: unknown file %q, expected one of %s\n", f, strings.Join(ProjectFileNames(), ", "))
+			os.Exit(2)
+		}
+	}
+
+	tap.Intro(banner)
+
+	if len(files) == 0 {
+		var options []tap.SelectOption[string]
+		for _, f := range projectFiles {
+			options = append(options, tap.SelectOption[string]{Value: f.Name, Label: f.Name, Hint: f.Hint})
+		}
+
+		files = tap.MultiSelect(context.Background(), tap.MultiSelectOptions[string]{
+			Message:       fmt.Sprintf("Which files do you want in %s?", utils.TildePath(abs)),
+			Options:       options,
+			InitialValues: ProjectFileNames(),
+		})
+
+		if len(files) == 0 {
+			tap.Outro(utils.Style("🛑 [ABORTED]: No files selected.", "orange"))
+			os.Exit(0)
+		}
+	}
+
+	// Sources from the saved config apply to project files too.
+	conf, _ := config.Load()
+
+	steps, err := planProject(conf, abs, files, time.Now())
+	if err != nil {
+		tap.Outro(utils.Style(fmt.Sprintf("❌ [ERROR]: %v", err), "red"))
+		os.Exit(1)
+	}
+
+	res := &config.Result{Operation: "init-project", DryRun: dryRun}
+	executeConfigure(steps, dryRun, res)
+
+	var sections []string
+	if len(res.Succeeded) > 0 {
+		header := fmt.Sprintf("📁 [WRITTEN]: %d files in %s", len(res.Succeeded), utils.TildePath(abs))
+		if dryRun {
+			header = utils.Style(fmt.Sprintf("___ [DRY_RUN]: Would write %d files in %s ___", len(res.Succeeded), utils.TildePath(abs)), "orange")
+		}
+		sections = append(sections, fmt.Sprintf("%s\n   %s", header, utils.Style(strings.Join(res.Succeeded, ", "), "cyan")))
+	}
+	if len(res.Skipped) > 0 {
+		sections = append(sections, fmt.Sprintf("The following files were skipped:\n   %s", utils.Style(strings.Join(res.Skipped, ", "), "orange")))
+	}
+	if len(res.Failed) > 0 {
+		sections = append(sections, utils.Style(fmt.Sprintf("❌ [FAILED]: %s", strings.Join(res.Failed, ", ")), "red"))
+	}
+
+	if len(sections) == 0 {
+		sections = append(sections, "✨ No files were processed.")
+	}
+	tap.Outro(strings.Join(sections, "\n\n"))
+	time.Sleep(time.Millisecond * 100)
+
+	if len(res.Failed) > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// planProject writes each of files into dir. An existing file is backed up
+// under its path relative to $HOME, so `stash backups restore` can put it
+// back, and an existing .vscode/settings.json is merged into rather than
+// replaced.
+func planProject(c *config.Config, dir string, files []string, now time.Time) ([]config.Step, error) {
+	var steps []config.Step
+
+	for _, f := range projectFiles {
+		if !slices.Contains(files, f.Name) {
+			continue
+		}
+
+		content, source, err := readDotfile(c, path.Dir(f.Source), path.Base(f.Source))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", source, err)
+		}
+
+		target := filepath.Join(dir, f.Name)
+		write := config.Step{Kind: config.StepWrite, File: f.Name, Path: target, Includes: []string{source}}
+
+		if f.Name == ".vscode/settings.json" {
+			merge, err := mergeJSONFile(target, content)
+			if err != nil {
+				return nil, err
+			}
+			content = merge.Content
+			write.Action, write.Changes, write.Owned = "merge", merge.Changes, merge.Owned
+		}
+
+		if _, err := os.Stat(target); err == nil {
+			steps = append(steps, config.Step{Kind: config.StepBackup, File: f.Name, Path: target, Source: utils.BackupPath(homeRelative(target), now)})
+		}
+
+		write.Hash, write.Content = hashContent(content), content
+		steps = append(steps, write)
+	}
+
+	return steps, nil
+}
+
+// homeRelative returns path relative to $HOME, the form backups are named
+// by.
+func homeRelative(p string) string {
+	home, _ := os.UserHomeDir()
+	if rel, err := filepath.Rel(home, p); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return p
+}
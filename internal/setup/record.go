@@ -0,0 +1,106 @@
+package setup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/huffmanks/stash/internal/catalog"
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+func recordPath() string {
+	return filepath.Join(utils.StashDir(), "record.json")
+}
+
+// loadRecord returns what stash has done to this machine so far, see
+// config.Record.
+func loadRecord() *config.Record {
+	record := &config.Record{}
+	if data, err := os.ReadFile(recordPath()); err == nil {
+		_ = json.Unmarshal(data, record)
+	}
+	return record
+}
+
+func saveRecord(record *config.Record) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(utils.StashDir(), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(recordPath(), data, 0644)
+}
+
+// recordWrite notes that stash wrote the file at path, backed up to backup
+// first ("" when it did not exist). Only the first write is kept, since
+// its backup is the file as it was before stash. A version of stash from
+// before the record may have written the file already, so the oldest
+// backup of file is used when there is one.
+func recordWrite(file, path, backup string) error {
+	record := loadRecord()
+	if slices.ContainsFunc(record.Files, func(f config.RecordedFile) bool { return f.Path == path }) {
+		return nil
+	}
+
+	if backups, err := utils.ListBackups(); err == nil {
+		if _, groups := utils.GroupBackups(backups); len(groups[file]) > 0 {
+			backup = groups[file][0].Path
+		}
+	}
+
+	record.Files = append(record.Files, config.RecordedFile{File: file, Path: path, Backup: backup, Time: time.Now()})
+	return saveRecord(record)
+}
+
+// recordedBackups returns the backups taken before stash first wrote each
+// file. They are what a full uninstall restores, so pruning keeps them.
+func recordedBackups() map[string]bool {
+	originals := map[string]bool{}
+	for _, f := range loadRecord().Files {
+		if f.Backup != "" {
+			originals[filepath.Clean(f.Backup)] = true
+		}
+	}
+	return originals
+}
+
+// recordInstall notes a package stash installed or a plugin it cloned,
+// from the step that did it.
+func recordInstall(s config.Step) error {
+	record := loadRecord()
+	now := time.Now()
+
+	switch s.Kind {
+	case config.StepClone:
+		if slices.ContainsFunc(record.Clones, func(c config.RecordedClone) bool { return c.Path == s.Path }) {
+			return nil
+		}
+		record.Clones = append(record.Clones, config.RecordedClone{Package: s.Package, Path: s.Path, Time: now})
+
+	default:
+		if slices.ContainsFunc(record.Packages, func(p config.RecordedPackage) bool { return p.Package == s.Package }) {
+			return nil
+		}
+
+		p := config.RecordedPackage{Package: s.Package, Kind: s.Kind, Manager: s.Manager, Time: now}
+		if s.Manager != "" {
+			p.Name = s.Package
+			if cat, _ := catalog.Load(); cat != nil {
+				if pkg, ok := cat.Get(s.Package); ok {
+					p.Name = pkg.NameFor(s.Manager)
+				}
+			}
+		}
+		record.Packages = append(record.Packages, p)
+	}
+
+	return saveRecord(record)
+}
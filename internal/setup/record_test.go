@@ -0,0 +1,44 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+func TestRecordWriteUsesOldestBackup(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := os.MkdirAll(utils.StashDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The 2020 backup is the user's original; stash wrote the file before
+	// it kept a record, so the 2021 backup is its own earlier output.
+	var paths []string
+	for _, name := range []string{"bak_20200101_000000_.zshrc", "bak_20210101_000000_.zshrc"} {
+		p := filepath.Join(utils.StashDir(), name)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	target := utils.TargetPath(".zshrc")
+	if err := recordWrite(".zshrc", target, paths[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordWrite(".zshrc", target, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	files := loadRecord().Files
+	if len(files) != 1 {
+		t.Fatalf("record has %d files, want 1", len(files))
+	}
+	if files[0].Backup != paths[0] {
+		t.Errorf("recorded backup = %s, want the oldest %s", files[0].Backup, paths[0])
+	}
+}
@@ -0,0 +1,243 @@
+package setup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/huffmanks/stash/internal/catalog"
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+type shellTarget struct {
+	osFolder   string
+	archFolder string
+	displayOS  string
+	arch       string
+}
+
+func newShellTarget(goos, arch string) shellTarget {
+	osFolder := map[string]string{"darwin": "macos"}[goos]
+	if osFolder == "" {
+		osFolder = goos
+	}
+
+	archFolder := "intel"
+	if arch == "arm64" {
+		archFolder = "arm"
+	}
+
+	displayOS := "Linux"
+	if goos == "darwin" {
+		displayOS = "macOS"
+	}
+
+	if utils.IsAndroid() {
+		archFolder = "android"
+		displayOS = "Android"
+	}
+
+	return shellTarget{osFolder: osFolder, archFolder: archFolder, displayOS: displayOS, arch: arch}
+}
+
+// shellFragment maps a catalog fragment such as exports/go.zsh to the file
+// name it has in the fragment tree of shell.
+func shellFragment(fragment, shell string) string {
+	return strings.TrimSuffix(fragment, path.Ext(fragment)) + "." + shell
+}
+
+// shellFragments are the fragments that make up an rc file, by section.
+type shellFragments struct {
+	config, exports, prompt, aliases, plugins []fragment
+}
+
+func (f shellFragments) all() []fragment {
+	return slices.Concat(f.config, f.exports, f.prompt, f.aliases, f.plugins)
+}
+
+// collectShellRC finds the fragments for the rc file of shell in the
+// embedded tree, the sources and the user overlay.
+func collectShellRC(c *config.Config, shell, goos, arch string) (layers, shellFragments, error) {
+	t := newShellTarget(goos, arch)
+	var frags shellFragments
+
+	layers, err := newLayers(c, "."+shell)
+	if err != nil {
+		return nil, frags, err
+	}
+	ext := "." + shell
+
+	categorize := func(dirPath string) {
+		for _, f := range layers.ReadDir(dirPath, ext) {
+			base := path.Base(f.Name)
+
+			switch {
+			case strings.Contains(base, "config"):
+				frags.config = append(frags.config, f)
+			case strings.Contains(base, "prompt"):
+				frags.prompt = append(frags.prompt, f)
+			case strings.Contains(base, "aliases"):
+				frags.aliases = append(frags.aliases, f)
+			}
+		}
+	}
+
+	categorize("common")
+	categorize(t.osFolder)
+	categorize(path.Join(t.osFolder, t.archFolder))
+
+	pkgs := slices.Clone(c.SelectedPkgs)
+	slices.Sort(pkgs)
+
+	searchLevels := []string{
+		path.Join(t.osFolder, t.archFolder),
+		t.osFolder,
+		"common",
+	}
+
+	cat, _ := catalog.Load()
+
+	// Fragments that belong to a catalog package are only included when it
+	// is selected; any other source or overlay fragment is always included.
+	owned := map[string]bool{}
+	for _, p := range cat.Packages {
+		for _, fragment := range p.Fragments {
+			owned[shellFragment(fragment, shell)] = true
+		}
+	}
+
+	collectFiles := func(subDir string) []fragment {
+		var collected []fragment
+		for _, name := range pkgs {
+			pkg, ok := cat.Get(name)
+			if !ok {
+				continue
+			}
+
+			for _, fragment := range pkg.Fragments {
+				fragment = shellFragment(fragment, shell)
+				if path.Dir(fragment) != subDir {
+					continue
+				}
+
+				for _, level := range searchLevels {
+					if f, ok := layers.Stat(path.Join(level, fragment)); ok {
+						collected = append(collected, f)
+					}
+				}
+			}
+		}
+
+		for _, level := range searchLevels {
+			for _, f := range layers.ReadDir(path.Join(level, subDir), ext) {
+				if !layers.Embedded(f) && !owned[path.Join(subDir, path.Base(f.Name))] {
+					collected = append(collected, f)
+				}
+			}
+		}
+		return collected
+	}
+
+	frags.exports = collectFiles("exports")
+	frags.plugins = collectFiles("plugins")
+
+	return layers, frags, nil
+}
+
+// renderShellRC assembles the rc file for shell from the embedded
+// fragments, the sources and the user overlay, rendering each through
+// text/template with the config's vars, and returns the content along with
+// the fragments it included, in order.
+func renderShellRC(c *config.Config, shell, goos, arch string) ([]byte, []string, error) {
+	t := newShellTarget(goos, arch)
+
+	layers, frags, err := collectShellRC(c, shell, goos, arch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vars := fragmentVars(c)
+	var renderErr error
+
+	var finalBuffer bytes.Buffer
+	var included []string
+	exportsHeaderAdded := false
+	pluginsHeaderAdded := false
+
+	appendSection := func(files []fragment, isExport bool, isPlugin bool) {
+		if len(files) == 0 {
+			return
+		}
+
+		for i, f := range files {
+			data, err := layers.ReadFile(f)
+			if err != nil {
+				continue
+			}
+			if data, err = renderFragment(layers.Source(f), data, vars); err != nil {
+				renderErr = errors.Join(renderErr, err)
+				continue
+			}
+			included = append(included, layers.Source(f))
+
+			if isExport && !exportsHeaderAdded {
+				fmt.Fprint(&finalBuffer, "# =====================================\n# Exports\n# =====================================\n\n")
+				exportsHeaderAdded = true
+			}
+
+			if isPlugin && !pluginsHeaderAdded {
+				fmt.Fprintf(&finalBuffer, "# =====================================\n# Plugins (%s:%s)\n# =====================================\n\n", t.displayOS, t.arch)
+				pluginsHeaderAdded = true
+			}
+
+			finalBuffer.Write(data)
+			if !isPlugin || i < len(files)-1 {
+				finalBuffer.WriteByte('\n')
+			}
+		}
+	}
+
+	appendSection(frags.config, false, false)
+	appendSection(frags.exports, true, false)
+	appendSection(frags.prompt, false, false)
+	appendSection(frags.aliases, false, false)
+	appendSection(frags.plugins, false, true)
+
+	if renderErr != nil {
+		return nil, nil, renderErr
+	}
+
+	return finalBuffer.Bytes(), included, nil
+}
+
+// findProfile returns the most specific login profile of shell for the
+// target from the topmost layer that has one, or nil when the platform has
+// none.
+func findProfile(c *config.Config, shell, goos, arch string) ([]byte, string, error) {
+	t := newShellTarget(goos, arch)
+	layers, err := newLayers(c, "."+shell)
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := config.ShellProfile[shell]
+	searchPaths := []string{
+		path.Join(t.osFolder, t.archFolder, name),
+		path.Join(t.osFolder, name),
+		path.Join("common", name),
+	}
+
+	for _, p := range searchPaths {
+		if f, ok := layers.Stat(p); ok {
+			if data, err := layers.ReadFile(f); err == nil {
+				return data, layers.Source(f), nil
+			}
+		}
+	}
+
+	return nil, "", nil
+}
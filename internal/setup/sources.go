@@ -0,0 +1,159 @@
+package setup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+var (
+	sourcesMu     sync.Mutex
+	syncedSources = map[string]error{}
+)
+
+func sourcesDir() string {
+	return filepath.Join(utils.StashDir(), "sources")
+}
+
+// openSource returns the root of a dotfile source along with a label for
+// the build manifest. The root has the same layout as the embedded
+// .dotfiles directory (.zsh/..., git/ignore/...); a .dotfiles directory at
+// the top of the source is used as the root when present.
+func openSource(s config.Source) (fs.FS, string, error) {
+	var dir, label string
+
+	switch {
+	case s.Path != "":
+		dir = s.Path
+		if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+			home, _ := os.UserHomeDir()
+			dir = filepath.Join(home, rest)
+		}
+		label = utils.TildePath(dir)
+
+		if _, err := os.Stat(dir); err != nil {
+			return nil, "", fmt.Errorf("source %s: %w", s.Path, err)
+		}
+
+	case s.Git != "":
+		var err error
+		if dir, err = syncGitSource(s); err != nil {
+			return nil, "", err
+		}
+		label = s.Git
+		if s.Ref != "" {
+			label += "@" + s.Ref
+		}
+
+	default:
+		return nil, "", fmt.Errorf("source needs a path or git url")
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, ".dotfiles")); err == nil && info.IsDir() {
+		dir = filepath.Join(dir, ".dotfiles")
+	}
+
+	return os.DirFS(dir), label, nil
+}
+
+// syncGitSource clones the repository into the sources cache, or fetches
+// it when it is already there, and checks out the configured ref. Each
+// source is synced once per run. When a fetch fails but a checkout is
+// cached, the cached copy is used so stash still works offline.
+func syncGitSource(s config.Source) (string, error) {
+	dir := filepath.Join(sourcesDir(), sourceDirName(s.Git))
+
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	key := s.Git + "@" + s.Ref
+	if err, ok := syncedSources[key]; ok {
+		return dir, err
+	}
+
+	err := func() error {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+			if err := os.MkdirAll(sourcesDir(), 0755); err != nil {
+				return err
+			}
+			if err := git("", "clone", "--quiet", "--no-checkout", "--", s.Git, dir); err != nil {
+				os.RemoveAll(dir)
+				return fmt.Errorf("clone source %s: %w", s.Git, err)
+			}
+		} else if err := git(dir, "fetch", "--quiet", "--tags", "--force", "origin"); err != nil {
+			if git(dir, "rev-parse", "--verify", "--quiet", "HEAD") != nil {
+				return fmt.Errorf("fetch source %s: %w", s.Git, err)
+			}
+		}
+
+		ref := s.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+
+		// Prefer the remote branch so a moved branch is picked up, then
+		// fall back to tags and commits.
+		for _, candidate := range []string{"origin/" + ref, ref} {
+			if git(dir, "rev-parse", "--verify", "--quiet", candidate+"^{commit}") == nil {
+				if err := git(dir, "checkout", "--quiet", "--force", "--detach", candidate); err != nil {
+					return fmt.Errorf("checkout %s in source %s: %w", ref, s.Git, err)
+				}
+				return nil
+			}
+		}
+
+		return fmt.Errorf("source %s has no ref %q", s.Git, ref)
+	}()
+
+	syncedSources[key] = err
+	return dir, err
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sourceDirName turns a git URL into a readable, unique cache directory
+// name, e.g. github.com-team-dotfiles-1a2b3c4d.
+func sourceDirName(url string) string {
+	sum := sha256.Sum256([]byte(url))
+
+	name := url
+	if _, rest, ok := strings.Cut(name, "://"); ok {
+		name = rest
+	}
+	name = strings.TrimSuffix(name, ".git")
+	name = strings.Trim(unsafeChars.ReplaceAllString(name, "-"), "-.")
+
+	if len(name) > 48 {
+		name = name[len(name)-48:]
+	}
+
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+func git(dir string, args ...string) error {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package setup
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/huffmanks/stash/internal/config"
+)
+
+// newBareRepo creates a bare repository with one commit adding
+// git/ignore/team.gitignore and returns its path along with a working
+// clone to push further commits from.
+func newBareRepo(t *testing.T) (string, string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	bare := filepath.Join(root, "dotfiles.git")
+	work := filepath.Join(root, "work")
+
+	run(t, "", "init", "--quiet", "--bare", "--initial-branch=main", bare)
+	run(t, "", "clone", "--quiet", bare, work)
+	run(t, work, "checkout", "--quiet", "-b", "main")
+	commitFile(t, work, "git/ignore/team.gitignore", "first\n")
+
+	return bare, work
+}
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func commitFile(t *testing.T, work, name, content string) {
+	t.Helper()
+
+	file := filepath.Join(work, name)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, work, "add", "-A")
+	run(t, work, "commit", "--quiet", "-m", "update "+name)
+	run(t, work, "push", "--quiet", "origin", "HEAD:main")
+}
+
+// resetSources sets up an empty home and forgets which sources were
+// synced, as if stash was started again.
+func resetSources(t *testing.T) {
+	t.Helper()
+
+	sourcesMu.Lock()
+	syncedSources = map[string]error{}
+	sourcesMu.Unlock()
+
+	t.Setenv("HOME", t.TempDir())
+}
+
+func readSource(t *testing.T, s config.Source, name string) string {
+	t.Helper()
+
+	c := &config.Config{Sources: []config.Source{s}}
+	data, src, err := readDotfile(c, "git", name)
+	if err != nil {
+		t.Fatalf("readDotfile %s: %v", name, err)
+	}
+	if !strings.HasPrefix(src, s.Git) {
+		t.Fatalf("%s came from %s, want the source", name, src)
+	}
+	return string(data)
+}
+
+func TestGitSourceClone(t *testing.T) {
+	bare, _ := newBareRepo(t)
+	resetSources(t)
+
+	s := config.Source{Git: bare}
+	if got := readSource(t, s, "ignore/team.gitignore"); got != "first\n" {
+		t.Errorf("team.gitignore = %q, want %q", got, "first\n")
+	}
+
+	if _, err := os.Stat(filepath.Join(sourcesDir(), sourceDirName(bare), ".git")); err != nil {
+		t.Errorf("source not cloned into the sources cache: %v", err)
+	}
+}
+
+func TestGitSourceFetch(t *testing.T) {
+	bare, work := newBareRepo(t)
+	resetSources(t)
+
+	s := config.Source{Git: bare}
+	readSource(t, s, "ignore/team.gitignore")
+
+	commitFile(t, work, "git/ignore/team.gitignore", "second\n")
+
+	// A new run syncs the source again.
+	sourcesMu.Lock()
+	syncedSources = map[string]error{}
+	sourcesMu.Unlock()
+
+	if got := readSource(t, s, "ignore/team.gitignore"); got != "second\n" {
+		t.Errorf("team.gitignore after fetch = %q, want %q", got, "second\n")
+	}
+}
+
+func TestGitSourceRef(t *testing.T) {
+	bare, work := newBareRepo(t)
+	run(t, work, "tag", "v1")
+	run(t, work, "push", "--quiet", "origin", "v1")
+	first := run(t, work, "rev-parse", "HEAD")
+	commitFile(t, work, "git/ignore/team.gitignore", "second\n")
+
+	for _, ref := range []string{"v1", first, "main"} {
+		resetSources(t)
+
+		want := "first\n"
+		if ref == "main" {
+			want = "second\n"
+		}
+
+		if got := readSource(t, config.Source{Git: bare, Ref: ref}, "ignore/team.gitignore"); got != want {
+			t.Errorf("team.gitignore at %s = %q, want %q", ref, got, want)
+		}
+	}
+
+	resetSources(t)
+	c := &config.Config{Sources: []config.Source{{Git: bare, Ref: "nope"}}}
+	if _, _, err := readDotfile(c, "git", "ignore/team.gitignore"); err == nil {
+		t.Error("missing ref: want an error")
+	}
+}
+
+func TestSourceReplace(t *testing.T) {
+	bare, _ := newBareRepo(t)
+	resetSources(t)
+
+	layered := &config.Config{Sources: []config.Source{{Git: bare}}}
+	if _, _, err := readDotfile(layered, "git", "ignore/go.gitignore"); err != nil {
+		t.Fatalf("layered source hides the embedded go.gitignore: %v", err)
+	}
+
+	replaced := &config.Config{Sources: []config.Source{{Git: bare, Replace: true}}}
+	if _, _, err := readDotfile(replaced, "git", "ignore/go.gitignore"); err == nil {
+		t.Error("replace source still reads the embedded go.gitignore")
+	}
+	readSource(t, replaced.Sources[0], "ignore/team.gitignore")
+}
+
+func TestGitSourceOptionURL(t *testing.T) {
+	resetSources(t)
+
+	_, err := syncGitSource(config.Source{Git: "--upload-pack=touch pwned"})
+	if err == nil {
+		t.Fatal("clone of an option-like url: want an error")
+	}
+	if _, err := os.Stat("pwned"); err == nil {
+		os.Remove("pwned")
+		t.Error("url was read as a git option")
+	}
+}
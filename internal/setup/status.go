@@ -0,0 +1,201 @@
+package setup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// CheckStatus compares what the saved config asks for with what is on the
+// machine: selected packages that are missing, build files that differ from
+// what would be generated now, and backups older than staleAfter (zero
+// disables the backup check).
+func CheckStatus(c *config.Config, goos, arch string, staleAfter time.Duration) (*config.StatusReport, error) {
+	report := &config.StatusReport{
+		Packages:     []config.PkgStatus{},
+		Files:        []config.FileStatus{},
+		StaleBackups: []config.Backup{},
+	}
+
+	pm := c.PackageManager
+	if pm == "" {
+		pm = utils.DetectPackageManager()
+	}
+
+	report.Packages = ProbePackages(pm, c.SelectedPkgs, goos)
+	for _, p := range report.Packages {
+		if !p.Installed {
+			report.Drift = true
+		}
+	}
+
+	for _, file := range buildTargets(c) {
+		status := config.FileStatus{File: file, Path: utils.TargetPath(file)}
+
+		content, _, skip, err := renderTarget(c, file, goos, arch)
+		if err != nil {
+			return nil, err
+		}
+
+		if skip != "" {
+			status.State = "skipped"
+			report.Files = append(report.Files, status)
+			continue
+		}
+
+		content, _, _, err = targetContent(c, file, content)
+		if errors.Is(err, errUnterminatedBlock) {
+			// The block is broken, so the file cannot match what stash
+			// would write; configure skips it until it is fixed.
+			status.State = "modified"
+			if current, err := os.ReadFile(status.Path); err == nil {
+				status.Actual = hashContent(current)
+			}
+			report.Drift = true
+			report.Files = append(report.Files, status)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		status.Expected = hashContent(content)
+
+		current, err := os.ReadFile(status.Path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			status.State = "missing"
+		case err != nil:
+			return nil, err
+		case !bytes.Equal(current, content):
+			status.State = "modified"
+			status.Actual = hashContent(current)
+		default:
+			status.State = "ok"
+			status.Actual = status.Expected
+		}
+
+		if status.State != "ok" {
+			report.Drift = true
+		}
+
+		report.Files = append(report.Files, status)
+	}
+
+	if staleAfter > 0 {
+		backups, err := utils.ListBackups()
+		if err != nil {
+			return nil, err
+		}
+
+		// The originals from before stash are kept on purpose, not drift.
+		originals := recordedBackups()
+		cutoff := time.Now().Add(-staleAfter)
+		for _, b := range backups {
+			if b.Time.Before(cutoff) && !originals[filepath.Clean(b.Path)] {
+				report.StaleBackups = append(report.StaleBackups, b)
+				report.Drift = true
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// HandleStatus reports drift between the saved config and the machine and
+// exits 1 when any is found, 2 when there is no usable saved config.
+func HandleStatus(banner string, asJSON bool, staleAfter time.Duration) {
+	conf, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stash status: no saved config (%v), run stash first\n", err)
+		os.Exit(2)
+	}
+
+	report, err := CheckStatus(conf, runtime.GOOS, runtime.GOARCH, staleAfter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stash status: %v\n", err)
+		os.Exit(2)
+	}
+
+	code := 0
+	if report.Drift {
+		code = 1
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+		os.Exit(code)
+	}
+
+	tap.Intro(banner)
+
+	missing := 0
+	if len(report.Packages) > 0 {
+		rows := make([][]string, len(report.Packages))
+		for i, p := range report.Packages {
+			state := utils.Style("installed", "green")
+			if !p.Installed {
+				state = utils.Style("missing", "red")
+				missing++
+			}
+			rows[i] = []string{p.Name, state, utils.Style(p.Version, "dim")}
+		}
+		statusTable([]string{"Package", "State", "Version"}, rows)
+	}
+
+	changed := 0
+	if len(report.Files) > 0 {
+		rows := make([][]string, len(report.Files))
+		for i, f := range report.Files {
+			state := f.State
+			switch f.State {
+			case "ok":
+				state = utils.Style(state, "green")
+			case "skipped":
+				state = utils.Style(state, "dim")
+			default:
+				state = utils.Style(state, "red")
+				changed++
+			}
+			rows[i] = []string{f.File, state, utils.Style(utils.TildePath(f.Path), "dim")}
+		}
+		statusTable([]string{"File", "State", "Path"}, rows)
+	}
+
+	if len(report.StaleBackups) > 0 {
+		var lines []string
+		for _, b := range report.StaleBackups {
+			lines = append(lines, fmt.Sprintf("     - %s (%s)", filepath.Base(b.Path), b.Time.Format("2006-01-02")))
+		}
+		tap.Message(fmt.Sprintf("%s\n\n%s", utils.Style(fmt.Sprintf("🗄️  [STALE BACKUPS]: %d older than %s", len(report.StaleBackups), staleAfter), "orange"), utils.Style(strings.Join(lines, "\n"), "cyan")))
+	}
+
+	if report.Drift {
+		tap.Outro(utils.Style(fmt.Sprintf("⚠️  [DRIFT]: %d missing packages, %d changed files, %d stale backups", missing, changed, len(report.StaleBackups)), "orange"))
+	} else {
+		tap.Outro("✅ [IN SYNC]: machine matches the saved config.")
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	os.Exit(code)
+}
+
+func statusTable(headers []string, rows [][]string) {
+	tap.Table(headers, rows, tap.TableOptions{
+		ShowBorders:   true,
+		IncludePrefix: true,
+		HeaderStyle:   tap.TableStyleBold,
+		HeaderColor:   tap.TableColorGreen,
+	})
+}
@@ -0,0 +1,248 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// HandleUninstall removes stash. Besides the binary it can remove stash's
+// state in ~/.config/stash, or first revert everything in the record:
+// restore each file stash wrote to the backup taken before its first write,
+// delete the plugins it cloned and, if asked, uninstall the packages it
+// installed.
+func HandleUninstall(banner string, dryRun bool) {
+	ctx := context.Background()
+
+	tap.Intro(banner)
+
+	binaryPath, err := utils.ExecutablePath()
+	if err != nil {
+		tap.Outro(utils.Style(fmt.Sprintf("🛑 [ABORTED]: stash binary not found: %v", err), "orange"))
+		os.Exit(0)
+	}
+
+	binaryHint := utils.TildePath(binaryPath)
+	if utils.BinaryNeedsRoot(binaryPath) {
+		binaryHint += ", requires root privileges"
+	}
+
+	_, recordErr := os.Stat(recordPath())
+	record := loadRecord()
+	record.Files = withOldestBackups(record.Files)
+
+	noValue := "no"
+	choice := tap.Select(ctx, tap.SelectOptions[string]{
+		Message:      "What do you want to remove?",
+		InitialValue: &noValue,
+		Options: []tap.SelectOption[string]{
+			{Value: "binary", Label: "The binary only", Hint: binaryHint},
+			{Value: "state", Label: "The binary and stash's state", Hint: "config, backups and kept versions in ~/.config/stash"},
+			{Value: "full", Label: "Everything stash changed", Hint: fmt.Sprintf("%d files, %d plugins, %d packages", len(record.Files), len(record.Clones), len(record.Packages))},
+			{Value: "no", Label: "Nothing, keep stash"},
+		},
+	})
+
+	if choice == "no" {
+		tap.Outro(utils.Style("🛑 [ABORTED]: stash remains installed.", "orange"))
+		os.Exit(0)
+	}
+
+	var manual []string
+	if choice == "full" {
+		if recordErr != nil {
+			tap.Message(utils.Style("⚠️  [NO RECORD]: no record.json, restoring each file from its oldest backup. Plugins and packages are left in place.", "orange"))
+			time.Sleep(time.Millisecond * 100)
+		}
+
+		removePkgs := false
+		if len(record.Packages) > 0 {
+			removePkgs = tap.Confirm(ctx, tap.ConfirmOptions{
+				Message:      fmt.Sprintf("Also uninstall the %d packages stash installed?", len(record.Packages)),
+				InitialValue: false,
+			})
+		}
+
+		manual = revertRecord(record, removePkgs, dryRun)
+	}
+
+	spinner := tap.NewSpinner(tap.SpinnerOptions{
+		Delay: time.Millisecond * 100,
+	})
+	spinner.Start("Uninstalling stash...")
+	time.Sleep(time.Millisecond * 100)
+
+	if choice == "state" || choice == "full" {
+		if dryRun {
+			spinner.Message(utils.Style(fmt.Sprintf("___ [DRY_RUN]: Would remove: %s ___", utils.TildePath(utils.StashDir())), "orange"))
+		} else if err := os.RemoveAll(utils.StashDir()); err != nil {
+			spinner.Message(utils.Style(fmt.Sprintf("❌ [ERROR]: removing %s - %v", utils.TildePath(utils.StashDir()), err), "red"))
+		} else {
+			spinner.Message(fmt.Sprintf("🗑️  [REMOVED]: %s", utils.TildePath(utils.StashDir())))
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	errorMsg := fmt.Sprintf("❌ %s\n   %s\n      %s\n      %s", utils.Style("[ERROR]: Failed to remove the binary.", "red"), utils.Style("To finish the cleanup, you can manually remove:", "dim"), utils.Style("• "+utils.TildePath(binaryPath), "cyan"), utils.Style("• ~/.config/stash", "cyan"))
+
+	if dryRun {
+		spinner.Message(utils.Style(fmt.Sprintf("___ [DRY_RUN]: Would remove: %s ___", utils.TildePath(binaryPath)), "orange"))
+		time.Sleep(time.Millisecond * 100)
+	} else if err := utils.RemoveBinary(binaryPath, errorMsg); err != nil {
+		spinner.Stop("❌ [FAILED]: uninstalling stash.", 2)
+		tap.Outro(errorMsg)
+		os.Exit(1)
+	}
+
+	spinner.Stop("Uninstalling stash...", 0)
+	time.Sleep(time.Millisecond * 100)
+
+	if len(manual) > 0 {
+		tap.Message(fmt.Sprintf("💡 [INFO]: stash installed these with their own scripts; remove them by hand:\n\n   %s", utils.Style(strings.Join(manual, ", "), "cyan")))
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if dryRun {
+		tap.Outro(utils.Style("___ [DRY_RUN]: Nothing was removed. ___", "orange"))
+	} else {
+		tap.Outro("✅ [UNINSTALLED]: stash has been removed successfully.")
+	}
+	time.Sleep(time.Millisecond * 100)
+	os.Exit(0)
+}
+
+// revertRecord undoes what record says stash did, newest first, and
+// returns the packages stash installed by script, which it cannot remove.
+func revertRecord(record *config.Record, removePkgs, dryRun bool) []string {
+	spinner := tap.NewSpinner(tap.SpinnerOptions{
+		Delay: time.Millisecond * 100,
+	})
+	spinner.Start("Reverting files...")
+	time.Sleep(time.Millisecond * 100)
+
+	for _, f := range slices.Backward(record.Files) {
+		revertFile(f, dryRun, spinner)
+	}
+
+	for _, c := range slices.Backward(record.Clones) {
+		switch {
+		case dryRun:
+			spinner.Message(utils.Style(fmt.Sprintf("___ [DRY_RUN]: Would remove: %s ___", utils.TildePath(c.Path)), "orange"))
+		case os.RemoveAll(c.Path) != nil:
+			spinner.Message(utils.Style(fmt.Sprintf("❌ [ERROR]: removing %s", utils.TildePath(c.Path)), "red"))
+		default:
+			spinner.Message(fmt.Sprintf("🗑️  [REMOVED]: %s", utils.TildePath(c.Path)))
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	spinner.Stop("✅ [REVERTED]: files and plugins", 0)
+	time.Sleep(time.Millisecond * 100)
+
+	if !removePkgs {
+		return nil
+	}
+
+	var manual []string
+	var commands []string
+	for _, p := range slices.Backward(record.Packages) {
+		if p.Manager == "" {
+			manual = append(manual, p.Package)
+			continue
+		}
+
+		cmd, err := pmRemoveCmd(p.Manager, p.Name)
+		if err != nil {
+			manual = append(manual, p.Package)
+			continue
+		}
+		commands = append(commands, cmd)
+	}
+
+	if len(commands) == 0 {
+		return manual
+	}
+
+	progress := tap.NewProgress(tap.ProgressOptions{
+		Max:   len(commands),
+		Style: "heavy",
+		Size:  40,
+	})
+	progress.Start("Uninstalling packages...")
+	time.Sleep(time.Millisecond * 100)
+
+	for _, cmd := range commands {
+		if err := utils.RunCmd(cmd, dryRun, progress); err != nil {
+			progress.Advance(1, fmt.Sprintf("❌ [FAILED]: %s", cmd))
+		} else {
+			progress.Advance(1, fmt.Sprintf("✅ [REMOVED]: %s", cmd))
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	progress.Stop("🏁 [FINISHED]", 0)
+	time.Sleep(time.Millisecond * 100)
+
+	return manual
+}
+
+// revertFile puts back the file stash first replaced at f.Path, or removes
+// it when stash created it.
+func revertFile(f config.RecordedFile, dryRun bool, spinner *tap.Spinner) {
+	path := utils.TildePath(f.Path)
+
+	if f.Backup == "" {
+		if dryRun {
+			spinner.Message(utils.Style(fmt.Sprintf("___ [DRY_RUN]: Would remove: %s ___", path), "orange"))
+		} else if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			spinner.Message(utils.Style(fmt.Sprintf("❌ [ERROR]: removing %s - %v", path, err), "red"))
+		} else {
+			spinner.Message(fmt.Sprintf("🗑️  [REMOVED]: %s, stash created it", path))
+		}
+		time.Sleep(time.Millisecond * 100)
+		return
+	}
+
+	data, err := os.ReadFile(f.Backup)
+	if err != nil {
+		spinner.Message(utils.Style(fmt.Sprintf("⚠️  [MISSING]: the backup of %s, left as it is", path), "orange"))
+		time.Sleep(time.Millisecond * 100)
+		return
+	}
+
+	if err := utils.WriteTarget(f.Path, data, dryRun, spinner); err == nil && !dryRun {
+		spinner.Message(fmt.Sprintf("⏪ [RESTORED]: %s from before stash", path))
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+// withOldestBackups adds the files stash builds that it backed up but has
+// no record of, e.g. from a version before the record, to restore from
+// their oldest backup. Backups of project files from init-project are left
+// alone, since the record only covers files in $HOME.
+func withOldestBackups(files []config.RecordedFile) []config.RecordedFile {
+	backups, err := utils.ListBackups()
+	if err != nil {
+		return files
+	}
+
+	names, groups := utils.GroupBackups(backups)
+	for _, name := range names {
+		if !config.StashTarget(name) || slices.ContainsFunc(files, func(f config.RecordedFile) bool { return f.File == name }) {
+			continue
+		}
+
+		oldest := groups[name][0]
+		files = append(files, config.RecordedFile{File: name, Path: utils.TargetPath(name), Backup: oldest.Path, Time: oldest.Time})
+	}
+
+	return files
+}
@@ -0,0 +1,59 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+func TestWithOldestBackups(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := os.MkdirAll(utils.StashDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"bak_20200101_000000_.zshrc",
+		"bak_20210101_000000_.zshrc",
+		"bak_20200101_000000_.gitconfig",
+		"bak_20200101_000000_.config%git%work.gitconfig",
+		"bak_20200101_000000_projects%app%biome.json",
+		"bak_20200101_000000_notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(utils.StashDir(), name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorded := config.RecordedFile{File: ".gitconfig", Path: utils.TargetPath(".gitconfig")}
+	files := withOldestBackups([]config.RecordedFile{recorded})
+
+	got := map[string]string{}
+	for _, f := range files {
+		got[f.File] = f.Backup
+		if f.Backup != "" {
+			got[f.File] = filepath.Base(f.Backup)
+		}
+	}
+
+	want := map[string]string{
+		".gitconfig":                 "",
+		".zshrc":                     "bak_20200101_000000_.zshrc",
+		".config/git/work.gitconfig": "bak_20200101_000000_.config%git%work.gitconfig",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("withOldestBackups = %v, want %v", got, want)
+	}
+	for file, backup := range want {
+		if got[file] != backup {
+			t.Errorf("%s restores from %q, want %q", file, got[file], backup)
+		}
+	}
+
+	if _, ok := got["projects/app/biome.json"]; ok {
+		t.Error("init-project backup would be restored over the project file")
+	}
+}
@@ -0,0 +1,205 @@
+package setup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+)
+
+// fragmentVar is a variable shell fragments can use as {{.name}}. Vars
+// set in the config are available too, so overlays can define their own.
+type fragmentVar struct {
+	name    string
+	message string
+	detect  func() string
+}
+
+var knownVars = []fragmentVar{
+	{name: "timezone", message: "Timezone:", detect: detectTimezone},
+	{name: "editor", message: "Editor:", detect: detectEditor},
+	{name: "history_size", message: "History size:", detect: func() string { return "100000" }},
+	{name: "extra_path", message: "Extra PATH entries (colon separated):", detect: func() string { return "" }},
+}
+
+var fragmentFuncs = template.FuncMap{
+	// paths splits a colon separated list, dropping empty entries.
+	"paths":     splitPaths,
+	"shquote":   shquote,
+	"fishquote": fishquote,
+	// shpath quotes a colon separated list of paths for sh, bash and zsh
+	// like shquote, except that a leading ~ or $HOME still expands.
+	"shpath": func(s string) string {
+		parts := splitPaths(s)
+		for i, p := range parts {
+			parts[i] = quotePath(p, shquote)
+		}
+		return strings.Join(parts, ":")
+	},
+	// fishpath does the same for a single path in fish.
+	"fishpath": func(s string) string {
+		return quotePath(s, fishquote)
+	},
+}
+
+func splitPaths(s string) []string {
+	return slices.DeleteFunc(strings.Split(s, ":"), func(p string) bool { return strings.TrimSpace(p) == "" })
+}
+
+// shquote quotes a value for sh, bash and zsh, so quotes, $(...) and
+// backticks in it stay literal.
+func shquote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishquote does the same for fish, where a backslash inside single quotes
+// escapes a quote or another backslash.
+func fishquote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// quotePath quotes p with quote, leaving a leading ~, $HOME or ${HOME}
+// outside the quotes as "$HOME" so the shell expands it. Both shell
+// families join "$HOME"'/bin' into one word.
+func quotePath(p string, quote func(string) string) string {
+	for _, prefix := range []string{"~", "$HOME", "${HOME}"} {
+		rest, ok := strings.CutPrefix(p, prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			continue
+		}
+		if rest == "" {
+			return `"$HOME"`
+		}
+		return `"$HOME"` + quote(rest)
+	}
+	return quote(p)
+}
+
+// DefaultVars returns the known variables with values detected from the
+// system.
+func DefaultVars() map[string]string {
+	vars := map[string]string{}
+	for _, v := range knownVars {
+		vars[v.name] = v.detect()
+	}
+	return vars
+}
+
+// VarMessage is the prompt shown when asking for name.
+func VarMessage(name string) string {
+	for _, v := range knownVars {
+		if v.name == name {
+			return v.message
+		}
+	}
+	return name + ":"
+}
+
+// fragmentVars is the template data for fragments: detected defaults
+// overridden by the config's vars.
+func fragmentVars(c *config.Config) map[string]string {
+	vars := DefaultVars()
+	for k, v := range c.Vars {
+		vars[k] = v
+	}
+	return vars
+}
+
+func renderFragment(name string, data []byte, vars map[string]string) ([]byte, error) {
+	if !bytes.Contains(data, []byte("{{")) {
+		return data, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(fragmentFuncs).Option("missingkey=zero").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, fmt.Errorf("render %s: %w", name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+var varRef = regexp.MustCompile(`\.([A-Za-z_][A-Za-z0-9_]*)`)
+var actionRe = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// ReferencedVars returns the variables used by the fragments of the shell
+// rc files in c.BuildFiles, in the order they first appear.
+func ReferencedVars(c *config.Config, goos, arch string) ([]string, error) {
+	var names []string
+
+	for _, file := range c.BuildFiles {
+		shell, ok := config.RCShell(file)
+		if !ok {
+			continue
+		}
+
+		ls, frags, err := collectShellRC(c, shell, goos, arch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range frags.all() {
+			data, err := ls.ReadFile(f)
+			if err != nil {
+				continue
+			}
+
+			for _, action := range actionRe.FindAll(data, -1) {
+				for _, m := range varRef.FindAllSubmatch(action, -1) {
+					if name := string(m[1]); !slices.Contains(names, name) {
+						names = append(names, name)
+					}
+				}
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func detectTimezone() string {
+	if tz := os.Getenv("TZ"); tz != "" {
+		return strings.TrimPrefix(tz, ":")
+	}
+
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		if tz := strings.TrimSpace(string(data)); tz != "" {
+			return tz
+		}
+	}
+
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, tz, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return tz
+		}
+	}
+
+	return "UTC"
+}
+
+func detectEditor() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(env); editor != "" {
+			return editor
+		}
+	}
+
+	for _, editor := range []string{"nvim", "vim", "nano", "vi"} {
+		if utils.CommandExists(editor) {
+			return editor
+		}
+	}
+
+	return ""
+}
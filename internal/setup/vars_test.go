@@ -0,0 +1,73 @@
+package setup
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/huffmanks/stash/internal/assets"
+)
+
+func TestRenderFragmentQuoting(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		vars map[string]string
+		want string
+	}{
+		{`export EDITOR={{shquote .editor}}`, map[string]string{"editor": `it's $(id) "x" ` + "`y`"}, `export EDITOR='it'\''s $(id) "x" ` + "`y`'"},
+		{`set -gx EDITOR {{fishquote .editor}}`, map[string]string{"editor": `it's a\b`}, `set -gx EDITOR 'it\'s a\\b'`},
+		{`export PATH="$PATH":{{shpath .extra_path}}`, map[string]string{"extra_path": "~/bin:/opt/tools/bin"}, `export PATH="$PATH":"$HOME"'/bin':'/opt/tools/bin'`},
+		{`export PATH="$PATH":{{shpath .extra_path}}`, map[string]string{"extra_path": "$HOME/go/bin:${HOME}:~user/bin"}, `export PATH="$PATH":"$HOME"'/go/bin':"$HOME":'~user/bin'`},
+		{`{{range paths .extra_path}}fish_add_path {{fishpath .}};{{end}}`, map[string]string{"extra_path": "~/bin:/opt/$(x)"}, `fish_add_path "$HOME"'/bin';fish_add_path '/opt/$(x)';`},
+	}
+
+	for _, tt := range tests {
+		got, err := renderFragment("test", []byte(tt.tmpl), tt.vars)
+		if err != nil {
+			t.Fatalf("render %q: %v", tt.tmpl, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("render %q\n got: %s\nwant: %s", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+// TestExtraPathExpandsHome sources the embedded bash config fragment and
+// checks that a ~ entry lands on PATH as the home directory.
+func TestExtraPathExpandsHome(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+
+	data, err := assets.Files.ReadFile(".dotfiles/.bash/common/config.bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := DefaultVars()
+	vars["extra_path"] = "~/bin:/opt/tools/bin"
+	vars["editor"] = `vi "$(touch pwned)"`
+
+	rendered, err := renderFragment("config.bash", data, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := string(rendered) + "\nprintf '%s\\n' \"$PATH\" \"$EDITOR\"\n"
+	cmd := exec.Command("bash", "--norc", "-c", script)
+	cmd.Dir = t.TempDir()
+	cmd.Env = []string{"HOME=/home/tester", "PATH=/usr/bin:/bin"}
+
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("bash: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if want := "/usr/bin:/bin:/home/tester/bin:/opt/tools/bin"; lines[0] != want {
+		t.Errorf("PATH = %q, want %q", lines[0], want)
+	}
+	if want := `vi "$(touch pwned)"`; lines[len(lines)-1] != want {
+		t.Errorf("EDITOR = %q, want %q", lines[len(lines)-1], want)
+	}
+}
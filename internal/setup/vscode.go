@@ -0,0 +1,10 @@
+package setup
+
+import "github.com/huffmanks/stash/internal/config"
+
+// readVSCodeSettings returns .vscode/global.settings.json from the topmost
+// layer that has one. It is merged into the user's settings rather than
+// written over them, see targetContent.
+func readVSCodeSettings(c *config.Config) ([]byte, string, error) {
+	return readDotfile(c, ".vscode", "global.settings.json")
+}
@@ -0,0 +1,150 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// promptRestore asks which file to restore and which of its backups to use.
+// It returns false when the user goes back.
+func promptRestore(ctx context.Context, conf *config.Config) bool {
+	backups, err := utils.ListBackups()
+	if err != nil {
+		tap.Outro(utils.Style(fmt.Sprintf("❌ [ERROR]: %v", err), "red"))
+		os.Exit(1)
+	}
+
+	files, groups := utils.GroupBackups(backups)
+	files = slices.DeleteFunc(files, func(f string) bool { return f == "" })
+
+	if len(files) == 0 {
+		tap.Outro("✨ [EMPTY]: No backups found to restore.")
+		os.Exit(0)
+	}
+
+	fileOpts := []tap.SelectOption[string]{{Value: "back", Label: "⬅ Back"}}
+	for _, f := range files {
+		fileOpts = append(fileOpts, tap.SelectOption[string]{
+			Value: f,
+			Label: f,
+			Hint:  fmt.Sprintf("%d backups", len(groups[f])),
+		})
+	}
+
+	file := tap.Select(ctx, tap.SelectOptions[string]{
+		Message: "Which file do you want to restore?",
+		Options: fileOpts,
+	})
+	if file == "back" {
+		return false
+	}
+
+	// Newest first, that's usually the one you want.
+	matches := slices.Clone(groups[file])
+	slices.Reverse(matches)
+
+	backupOpts := make([]tap.SelectOption[string], len(matches))
+	for i, b := range matches {
+		backupOpts[i] = tap.SelectOption[string]{
+			Value: utils.FormatBackupTime(b.Time),
+			Label: b.Time.Format("2006-01-02 15:04:05"),
+			Hint:  utils.FormatSize(b.Size),
+		}
+	}
+
+	conf.Restore = file
+	conf.RestoreAt = tap.Select(ctx, tap.SelectOptions[string]{
+		Message: fmt.Sprintf("Which backup of %s?", file),
+		Options: backupOpts,
+	})
+
+	conf.Confirm = tap.Confirm(ctx, tap.ConfirmOptions{
+		Message:      fmt.Sprintf("Replace ~/%s with this backup? The current file will be backed up first.", file),
+		InitialValue: false,
+	})
+
+	if !conf.Confirm {
+		tap.Outro(utils.Style("🛑 [ABORTED]: No actions performed.", "orange"))
+		os.Exit(0)
+	}
+
+	return true
+}
+
+// promptRetention asks which backups a delete should keep. It returns false
+// when the user goes back.
+func promptRetention(ctx context.Context, conf, savedConf *config.Config) bool {
+	initial := "all"
+	switch {
+	case savedConf.KeepLast > 0:
+		initial = "keep-last"
+	case savedConf.KeepWithin != "":
+		initial = "keep-within"
+	}
+
+	policy := tap.Select(ctx, tap.SelectOptions[string]{
+		Message:      "Which backups do you want to delete?",
+		InitialValue: &initial,
+		Options: []tap.SelectOption[string]{
+			{Value: "back", Label: "⬅ Back"},
+			{Value: "all", Label: "All backups", Hint: "Except the originals a full uninstall restores"},
+			{Value: "keep-last", Label: "All but the newest", Hint: "Per file, plus the originals"},
+			{Value: "keep-within", Label: "Older than", Hint: "e.g. 30d, 2w, 12h, except the originals"},
+		},
+	})
+
+	switch policy {
+	case "back":
+		return false
+
+	case "keep-last":
+		initialN := ""
+		if savedConf.KeepLast > 0 {
+			initialN = strconv.Itoa(savedConf.KeepLast)
+		}
+
+		n := tap.Text(ctx, tap.TextOptions{
+			Message:      "How many backups of each file should be kept?",
+			Placeholder:  "3",
+			DefaultValue: "3",
+			InitialValue: initialN,
+			Validate: func(input string) error {
+				if input == "" {
+					return nil
+				}
+				if v, err := strconv.Atoi(input); err != nil || v < 1 {
+					return errors.New("Enter a number of 1 or more.")
+				}
+				return nil
+			},
+		})
+
+		conf.KeepLast, _ = strconv.Atoi(n)
+		conf.PerFile = true
+
+	case "keep-within":
+		conf.KeepWithin = tap.Text(ctx, tap.TextOptions{
+			Message:      "Keep backups newer than:",
+			Placeholder:  "30d",
+			DefaultValue: "30d",
+			InitialValue: savedConf.KeepWithin,
+			Validate: func(input string) error {
+				if input == "" {
+					return nil
+				}
+				_, err := config.ParseAge(input)
+				return err
+			},
+		})
+	}
+
+	return true
+}
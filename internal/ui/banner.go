@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 
+	"github.com/huffmanks/stash/internal/config"
 	"github.com/huffmanks/stash/internal/utils"
 )
 
@@ -24,5 +25,9 @@ func DisplayBanner(title string, description ...string) string {
 		content += fmt.Sprintf("%s\n", description[0])
 	}
 
+	if notice := utils.UpdateNotice(config.Version); notice != "" {
+		content += notice + "\n"
+	}
+
 	return content
 }
@@ -0,0 +1,309 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// promptGitExtras asks for the optional .gitconfig sections: commit
+// signing, pull/push defaults, rerere, aliases and a diff/merge tool, pre-
+// filled from the saved config.
+func promptGitExtras(ctx context.Context, conf, savedConf *config.Config) {
+	signing := savedConf.GitSigning
+	if signing == "" {
+		signing = "none"
+	}
+
+	conf.GitSigning = tap.Select(ctx, tap.SelectOptions[string]{
+		Message:      "Sign commits and tags?",
+		InitialValue: &signing,
+		Options: []tap.SelectOption[string]{
+			{Value: "none", Label: "No"},
+			{Value: "ssh", Label: "SSH key", Hint: "~/.ssh/*.pub"},
+			{Value: "gpg", Label: "GPG key", Hint: "gpg --list-secret-keys"},
+		},
+	})
+
+	conf.GitSigningKey = ""
+	if conf.GitSigning == "none" {
+		conf.GitSigning = ""
+	} else {
+		conf.GitSigningKey = promptSigningKey(ctx, conf.GitSigning, savedConf)
+	}
+
+	extras := savedConf.GitExtras
+	if savedConf.GitName == "" {
+		extras = []string{"pull_rebase", "auto_setup_remote"}
+	}
+
+	conf.GitExtras = tap.MultiSelect(ctx, tap.MultiSelectOptions[string]{
+		Message: "Which git defaults do you want?",
+		Options: []tap.SelectOption[string]{
+			{Value: "pull_rebase", Label: "pull.rebase", Hint: "Rebase instead of merge on pull"},
+			{Value: "auto_setup_remote", Label: "push.autoSetupRemote", Hint: "Push new branches without --set-upstream"},
+			{Value: "rerere", Label: "rerere", Hint: "Reuse recorded conflict resolutions"},
+			{Value: "aliases", Label: "Aliases", Hint: "st, co, sw, br, ci, amend, unstage, last, lg"},
+		},
+		InitialValues: extras,
+	})
+
+	tool := savedConf.GitTool
+	if tool == "" {
+		tool = "none"
+	}
+
+	options := []tap.SelectOption[string]{{Value: "none", Label: "None", Hint: "Keep git's default"}}
+	for _, t := range config.GitTools {
+		opt := tap.SelectOption[string]{Value: t, Label: t}
+
+		command := t
+		if t == "vscode" {
+			command = "code"
+		}
+		if !utils.CommandExists(command) {
+			opt.Hint = "not installed"
+		}
+		options = append(options, opt)
+	}
+
+	conf.GitTool = tap.Select(ctx, tap.SelectOptions[string]{
+		Message:      "Diff and merge tool:",
+		InitialValue: &tool,
+		Options:      options,
+	})
+	if conf.GitTool == "none" {
+		conf.GitTool = ""
+	}
+}
+
+// promptSigningKey offers the keys found for format, falling back to
+// asking for one when there are none or the user wants another.
+func promptSigningKey(ctx context.Context, format string, savedConf *config.Config) string {
+	keys := utils.SigningKeys(format)
+
+	if len(keys) > 0 {
+		options := make([]tap.SelectOption[string], 0, len(keys)+1)
+		for _, k := range keys {
+			options = append(options, tap.SelectOption[string]{Value: k.Key, Label: k.Label})
+		}
+		options = append(options, tap.SelectOption[string]{Value: "other", Label: "Another key"})
+
+		var initial *string
+		if slices.ContainsFunc(keys, func(k config.SigningKey) bool { return k.Key == savedConf.GitSigningKey }) {
+			initial = &savedConf.GitSigningKey
+		}
+
+		key := tap.Select(ctx, tap.SelectOptions[string]{
+			Message:      "Signing key:",
+			InitialValue: initial,
+			Options:      options,
+		})
+		if key != "other" {
+			return key
+		}
+	}
+
+	placeholder := "~/.ssh/id_ed25519.pub"
+	if format == "gpg" {
+		placeholder = "3AA5C34371567BD2"
+	}
+
+	initial := ""
+	if savedConf.GitSigning == format {
+		initial = savedConf.GitSigningKey
+	}
+
+	return tap.Text(ctx, tap.TextOptions{
+		Message:      "Signing key:",
+		Placeholder:  placeholder,
+		InitialValue: initial,
+		Validate: func(input string) error {
+			if strings.TrimSpace(input) == "" {
+				return errors.New("Signing key is required.")
+			}
+			return nil
+		},
+	})
+}
+
+// promptGitIdentities lets the user add, edit and remove the identities
+// used instead of the main name and email in some repos.
+func promptGitIdentities(ctx context.Context, conf, savedConf *config.Config) {
+	conf.GitIdentities = slices.Clone(savedConf.GitIdentities)
+
+	for {
+		options := make([]tap.SelectOption[string], 0, len(conf.GitIdentities)+2)
+		for _, id := range conf.GitIdentities {
+			options = append(options, tap.SelectOption[string]{Value: id.Name, Label: id.Name, Hint: identityHint(id)})
+		}
+		options = append(options,
+			tap.SelectOption[string]{Value: "add", Label: "➕ Add an identity", Hint: "e.g. a work email for ~/work"},
+			tap.SelectOption[string]{Value: "done", Label: "✔ Done"},
+		)
+
+		done := "done"
+		choice := tap.Select(ctx, tap.SelectOptions[string]{
+			Message:      "Other git identities, used in some directories or remotes:",
+			InitialValue: &done,
+			Options:      options,
+		})
+
+		switch choice {
+		case "done":
+			return
+		case "add":
+			conf.GitIdentities = append(conf.GitIdentities, promptGitIdentity(ctx, config.GitIdentity{}, conf.GitIdentities))
+			continue
+		}
+
+		i := slices.IndexFunc(conf.GitIdentities, func(id config.GitIdentity) bool { return id.Name == choice })
+
+		action := tap.Select(ctx, tap.SelectOptions[string]{
+			Message: fmt.Sprintf("What do you want to do with %s?", choice),
+			Options: []tap.SelectOption[string]{
+				{Value: "edit", Label: "Edit"},
+				{Value: "remove", Label: "Remove"},
+				{Value: "back", Label: "⬅ Back"},
+			},
+		})
+
+		switch action {
+		case "edit":
+			others := slices.Delete(slices.Clone(conf.GitIdentities), i, i+1)
+			conf.GitIdentities[i] = promptGitIdentity(ctx, conf.GitIdentities[i], others)
+		case "remove":
+			conf.GitIdentities = slices.Delete(conf.GitIdentities, i, i+1)
+		}
+	}
+}
+
+func promptGitIdentity(ctx context.Context, id config.GitIdentity, others []config.GitIdentity) config.GitIdentity {
+	id.Name = tap.Text(ctx, tap.TextOptions{
+		Message:      "Identity name:",
+		Placeholder:  "work",
+		InitialValue: id.Name,
+		Validate: func(input string) error {
+			if !config.ValidIdentityName(input) {
+				return errors.New("Use letters, digits, - or _.")
+			}
+			if slices.ContainsFunc(others, func(o config.GitIdentity) bool { return o.Name == input }) {
+				return errors.New("An identity with this name already exists.")
+			}
+			return nil
+		},
+	})
+
+	id.GitName = tap.Text(ctx, tap.TextOptions{
+		Message:      "Git Name:",
+		Placeholder:  "John Doe",
+		InitialValue: id.GitName,
+		Validate: func(input string) error {
+			if strings.TrimSpace(input) == "" {
+				return errors.New("Name is required.")
+			}
+			return nil
+		},
+	})
+
+	id.GitEmail = tap.Text(ctx, tap.TextOptions{
+		Message:      "Git Email:",
+		Placeholder:  "john@work.example.com",
+		InitialValue: id.GitEmail,
+		Validate: func(input string) error {
+			if !strings.Contains(input, "@") || !strings.Contains(input, ".") {
+				return errors.New("Email is invalid.")
+			}
+			return nil
+		},
+	})
+
+	for {
+		id.Dir = tap.Text(ctx, tap.TextOptions{
+			Message:      "Use it for repos under (leave empty to match by remote):",
+			Placeholder:  "~/work/",
+			InitialValue: id.Dir,
+		})
+
+		id.Remote = tap.Text(ctx, tap.TextOptions{
+			Message:      "Use it for repos with a remote matching (optional):",
+			Placeholder:  "git@github.com:acme/**",
+			InitialValue: id.Remote,
+		})
+
+		if strings.TrimSpace(id.Dir) != "" || strings.TrimSpace(id.Remote) != "" {
+			break
+		}
+		tap.Message(utils.Style("Set a directory, a remote or both!", "orange"))
+	}
+
+	id.Dir = strings.TrimSpace(id.Dir)
+	id.Remote = strings.TrimSpace(id.Remote)
+
+	id.SigningKey = tap.Text(ctx, tap.TextOptions{
+		Message:      "Signing key for this identity (optional):",
+		Placeholder:  "~/.ssh/id_work.pub",
+		InitialValue: id.SigningKey,
+	})
+
+	return id
+}
+
+// promptGitIgnore asks which fragments the global .gitignore is built from
+// and for any patterns of the user's own.
+func promptGitIgnore(ctx context.Context, conf, savedConf *config.Config) {
+	selected := savedConf.GitIgnore
+	if selected == nil {
+		selected = config.DefaultIgnoreFragments
+	}
+
+	groups := map[string]string{"os": "OS files", "editor": "Editor", "toolchain": "Toolchain", "common": "Common"}
+
+	options := make([]tap.SelectOption[string], 0, len(config.GitIgnoreFragments))
+	for _, f := range config.GitIgnoreFragments {
+		hint := groups[f.Group]
+		if len(f.Pkgs) > 0 {
+			hint += ", always with " + strings.Join(f.Pkgs, ", ")
+		}
+		options = append(options, tap.SelectOption[string]{Value: f.Name, Label: f.Label, Hint: hint})
+	}
+
+	conf.GitIgnore = tap.MultiSelect(ctx, tap.MultiSelectOptions[string]{
+		Message:       "What should the global .gitignore cover?",
+		Options:       options,
+		InitialValues: selected,
+	})
+	if conf.GitIgnore == nil {
+		conf.GitIgnore = []string{}
+	}
+
+	patterns := tap.Text(ctx, tap.TextOptions{
+		Message:      "Your own patterns, comma separated (optional):",
+		Placeholder:  "*.local, scratch/",
+		InitialValue: strings.Join(savedConf.GitIgnorePatterns, ", "),
+	})
+
+	conf.GitIgnorePatterns = nil
+	for _, p := range strings.Split(patterns, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			conf.GitIgnorePatterns = append(conf.GitIgnorePatterns, p)
+		}
+	}
+}
+
+func identityHint(id config.GitIdentity) string {
+	var where []string
+	if id.Dir != "" {
+		where = append(where, id.Dir)
+	}
+	if id.Remote != "" {
+		where = append(where, id.Remote)
+	}
+	return fmt.Sprintf("%s <%s>, %s", id.GitName, id.GitEmail, strings.Join(where, ", "))
+}
@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/setup"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// promptInstalled probes the selected packages, asks what to do with the
+// ones that are already installed and returns one summary row per package.
+func promptInstalled(ctx context.Context, conf *config.Config) [][]string {
+	spinner := tap.NewSpinner(tap.SpinnerOptions{
+		Delay: time.Millisecond * 100,
+	})
+
+	spinner.Start("Checking installed packages...")
+	statuses := setup.ProbePackages(conf.PackageManager, conf.SelectedPkgs, runtime.GOOS)
+
+	installed := 0
+	for _, s := range statuses {
+		if s.Installed {
+			installed++
+		}
+	}
+
+	spinner.Stop(fmt.Sprintf("🔍 [CHECKED]: %d of %d already installed", installed, len(statuses)), 0)
+	time.Sleep(time.Millisecond * 100)
+
+	conf.PkgActions = map[string]string{}
+	skip := "skip"
+
+	var rows [][]string
+	for _, s := range statuses {
+		if !s.Installed {
+			rows = append(rows, []string{s.Name, utils.Style("install", "bold", "cyan")})
+			continue
+		}
+
+		version := s.Version
+		if version == "" {
+			version = s.Source
+		}
+
+		action := tap.Select(ctx, tap.SelectOptions[string]{
+			Message:      fmt.Sprintf("%s is already installed [%s]:", utils.Style(s.Name, "bold"), utils.Style(version, "dim")),
+			InitialValue: &skip,
+			Options: []tap.SelectOption[string]{
+				{Value: "skip", Label: "Skip"},
+				{Value: "reinstall", Label: "Reinstall"},
+				{Value: "upgrade", Label: "Upgrade"},
+			},
+		})
+		conf.PkgActions[s.Name] = action
+
+		rows = append(rows, []string{s.Name, fmt.Sprintf("%s %s", utils.Style(action, "bold", "orange"), utils.Style(version, "dim"))})
+	}
+
+	return rows
+}
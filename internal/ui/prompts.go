@@ -9,6 +9,7 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/huffmanks/stash/internal/catalog"
 	"github.com/huffmanks/stash/internal/config"
 	"github.com/huffmanks/stash/internal/utils"
 	"github.com/yarlson/tap"
@@ -18,7 +19,13 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 	ctx := context.Background()
 
 	savedConf, _ := config.Load()
-	conf := &config.Config{}
+
+	// Only set in the config file, never prompted for.
+	conf := &config.Config{
+		Sources:     savedConf.Sources,
+		Channel:     savedConf.Channel,
+		OnInstalled: savedConf.OnInstalled,
+	}
 
 	title := fmt.Sprintf("Welcome to stash! [%s]", utils.Style(version, "green"))
 
@@ -39,9 +46,10 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 			}
 
 			options := []tap.SelectOption[string]{
-				{Value: "configure", Label: "Configure shell", Hint: ".zshrc, .zprofile, .gitconfig, .gitignore"},
+				{Value: "configure", Label: "Configure shell", Hint: "zsh, bash or fish, .gitconfig, .gitignore, VS Code"},
 				{Value: "install", Label: "Install packages", Hint: "Using your package manager"},
 				{Value: "delete", Label: "Delete backup files", Hint: "~/.config/stash/bak**"},
+				{Value: "restore", Label: "Restore a backup", Hint: "~/.config/stash/bak**"},
 			}
 
 			conf.Operation = tap.Select(ctx, tap.SelectOptions[string]{
@@ -65,10 +73,14 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 					Options: []tap.SelectOption[string]{
 						{Value: "back", Label: "⬅ Back"},
 						{Value: "apt", Label: "apt", Hint: "Debian, Ubuntu"},
+						{Value: "apk", Label: "apk", Hint: "Alpine Linux"},
 						{Value: "dnf", Label: "dnf", Hint: "Fedora, RHEL, AlmaLinux"},
 						{Value: "homebrew", Label: "homebrew", Hint: "macOS"},
 						{Value: "macports", Label: "macports", Hint: "macOS"},
+						{Value: "nix", Label: "nix", Hint: "NixOS, any Linux or macOS with nix"},
 						{Value: "pacman", Label: "pacman", Hint: "Arch Linux"},
+						{Value: "xbps", Label: "xbps", Hint: "Void Linux"},
+						{Value: "zypper", Label: "zypper", Hint: "openSUSE"},
 					},
 				})
 				if conf.PackageManager == "back" {
@@ -80,29 +92,74 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 			}
 
 			if conf.Operation == "configure" {
-				options := []tap.SelectOption[string]{
-					{Value: ".zshrc", Label: ".zshrc"},
-					{Value: ".zprofile", Label: ".zprofile"},
-					{Value: ".gitconfig", Label: ".gitconfig", Hint: "Requires name and email"},
-					{Value: ".gitignore", Label: ".gitignore"},
+				initialShell := savedConf.Shell
+				if initialShell == "" {
+					initialShell = utils.DetectShell()
+				}
+
+				conf.Shell = tap.Select(ctx, tap.SelectOptions[string]{
+					Message:      "Which shell do you want to configure?",
+					InitialValue: &initialShell,
+					Options: []tap.SelectOption[string]{
+						{Value: "back", Label: "⬅ Back"},
+						{Value: "zsh", Label: "zsh", Hint: ".zshrc, .zprofile"},
+						{Value: "bash", Label: "bash", Hint: ".bashrc, .bash_profile"},
+						{Value: "fish", Label: "fish", Hint: "~/.config/fish/config.fish"},
+					},
+				})
+				if conf.Shell == "back" {
+					step = 1
+					continue
+				}
+
+				var options []tap.SelectOption[string]
+				for _, f := range config.ShellFiles(conf.Shell) {
+					options = append(options, tap.SelectOption[string]{Value: f, Label: f})
+				}
+				options = append(options,
+					tap.SelectOption[string]{Value: ".gitconfig", Label: ".gitconfig", Hint: "Requires name and email"},
+					tap.SelectOption[string]{Value: ".gitignore", Label: ".gitignore"},
+					tap.SelectOption[string]{Value: config.VSCodeSettings, Label: "VS Code settings", Hint: "Merged into " + utils.TildePath(utils.TargetPath(config.VSCodeSettings))},
+				)
+
+				var initialFiles []string
+				for _, f := range savedConf.BuildFiles {
+					if slices.ContainsFunc(options, func(o tap.SelectOption[string]) bool { return o.Value == f }) {
+						initialFiles = append(initialFiles, f)
+					}
 				}
 
 				conf.BuildFiles = tap.MultiSelect(ctx, tap.MultiSelectOptions[string]{
 					Message:       "What do you want built?",
 					Options:       options,
-					InitialValues: savedConf.BuildFiles,
+					InitialValues: initialFiles,
 				})
 
 				if len(conf.BuildFiles) == 0 {
 					tap.Message(utils.Style("At least one file must be selected!", "orange"))
 					continue
 				}
+
+				conf.Managed = tap.Confirm(ctx, tap.ConfirmOptions{
+					Message:      "Keep your own edits and only update a stash managed block in each file?",
+					InitialValue: savedConf.Managed,
+				})
 				step = 3
 			}
 
 			if conf.Operation == "delete" {
+				if !promptRetention(ctx, conf, savedConf) {
+					step = 1
+					continue
+				}
+
+				msg := "Are you sure you want to delete backup files?"
+				if conf.HasRetention() {
+					msg = "Are you sure you want to delete backup files outside the retention policy?"
+				}
+
 				conf.Confirm = tap.Confirm(ctx, tap.ConfirmOptions{
-					Message:      "Are you sure you want to delete backup files?",
+					Message:      msg,
 					InitialValue: false,
 				})
 
@@ -113,6 +170,15 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 
 				step = 6
 			}
+
+			if conf.Operation == "restore" {
+				if !promptRestore(ctx, conf) {
+					step = 1
+					continue
+				}
+
+				step = 6
+			}
 		case 3:
 			if slices.Contains(conf.BuildFiles, ".gitconfig") {
 				conf.GitName = tap.Text(ctx, tap.TextOptions{
@@ -146,39 +212,53 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 					Placeholder:  "main",
 					InitialValue: savedConf.GitBranch,
 				})
+
+				promptGitExtras(ctx, conf, savedConf)
+				promptGitIdentities(ctx, conf, savedConf)
+
+				if _, err := os.Stat(utils.HomePath(".gitconfig")); err == nil || savedConf.GitMerge {
+					conf.GitMerge = tap.Confirm(ctx, tap.ConfirmOptions{
+						Message:      "Merge into your existing ~/.gitconfig instead of replacing it?",
+						InitialValue: savedConf.GitMerge,
+					})
+				}
+			}
+
+			if slices.Contains(conf.BuildFiles, ".gitignore") {
+				promptGitIgnore(ctx, conf, savedConf)
 			}
 			step = 4
 		case 4:
 
-			if conf.Operation == "configure" && !slices.Contains(conf.BuildFiles, ".zshrc") {
+			if conf.Operation == "configure" && !config.HasShellRC(conf.BuildFiles) {
 				step = 5
 				continue
 			}
 
-			categories := map[string][]string{
-				"CLI tools": {},
-				"Exports":   {"bun", "docker", "go", "nvm", "pipx", "pnpm"},
-				"Plugins":   {"fzf", "zsh-autosuggestions", "zsh-syntax-highlighting"},
+			cat, err := catalog.Load()
+			if err != nil {
+				tap.Message(utils.Style(fmt.Sprintf("⚠️  [WARNING]: %v", err), "orange"))
 			}
 
-			if conf.Operation == "install" {
-				categories["CLI tools"] = []string{"bat", "fastfetch", "fd", "ffmpeg", "gh", "git", "jq", "just", "tree"}
-			}
-
-			if runtime.GOOS == "darwin" {
-				categories["Exports"] = append(categories["Exports"], "java-android-studio")
+			categories := map[string][]string{}
+			for _, name := range cat.Categories {
+				for _, p := range cat.InCategory(name, runtime.GOOS) {
+					pkg, _ := cat.Get(p)
+					if conf.Operation == "configure" && len(pkg.Fragments) == 0 {
+						continue
+					}
+					categories[name] = append(categories[name], p)
+				}
 			}
 
-			categoryOrder := []string{"CLI tools", "Exports", "Plugins"}
+			categoryOrder := cat.Categories
 
-			for _, cat := range categoryOrder {
-				pkgs := categories[cat]
+			for _, category := range categoryOrder {
+				pkgs := categories[category]
 				if len(pkgs) == 0 {
 					continue
 				}
 
-				slices.Sort(pkgs)
-
 				opts := make([]tap.SelectOption[string], len(pkgs))
 				for i, p := range pkgs {
 					opts[i] = tap.SelectOption[string]{Value: p, Label: p}
@@ -193,7 +273,7 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 				}
 
 				selected := tap.MultiSelect(ctx, tap.MultiSelectOptions[string]{
-					Message:       "Select " + cat,
+					Message:       "Select " + category,
 					Options:       opts,
 					InitialValues: initial,
 				})
@@ -202,6 +282,10 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 
 			}
 
+			if conf.Operation == "configure" {
+				promptVars(ctx, conf, savedConf)
+			}
+
 			step = 5
 			continue
 		case 5:
@@ -218,15 +302,17 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 				rows = append(rows, []string{"Build files", utils.Style(strings.Join(conf.BuildFiles, ", "), "bold", "cyan")})
 			}
 
-			if len(conf.SelectedPkgs) > 0 {
+			if conf.Operation == "install" && len(conf.SelectedPkgs) > 0 {
+				rows = append(rows, promptInstalled(ctx, conf)...)
+			} else if len(conf.SelectedPkgs) > 0 {
 				rows = append(rows, []string{"Packages", utils.Style(strings.Join(conf.SelectedPkgs, ", "), "bold", "cyan")})
 			}
 
 			hasPackages := len(conf.SelectedPkgs) > 0
-			includesZshrc := slices.Contains(conf.BuildFiles, ".zshrc")
+			includesRC := config.HasShellRC(conf.BuildFiles)
 
-			showSummary := (hasPackages && (conf.Operation == "install" || includesZshrc)) ||
-				(conf.Operation == "configure" && !includesZshrc)
+			showSummary := (hasPackages && (conf.Operation == "install" || includesRC)) ||
+				(conf.Operation == "configure" && !includesRC)
 
 			if showSummary {
 				tap.Table(headers, rows, tap.TableOptions{
@@ -247,7 +333,7 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 				}
 			} else {
 				var msg string
-				if conf.Operation == "install" || (!hasPackages && includesZshrc) {
+				if conf.Operation == "install" || (!hasPackages && includesRC) {
 					msg = utils.Style("No packages selected, do you want to start over?", "orange")
 				} else {
 					msg = utils.Style("No build files selected, do you want to start over?", "orange")
@@ -275,23 +361,43 @@ func RunPrompts(dryRun bool, version string) (*config.Config, error) {
 	}
 
 end:
-	if !dryRun {
+	// A restore is a one-off, so it never becomes the saved operation.
+	if !dryRun && conf.Operation != "restore" {
 		savedConf.Operation = conf.Operation
 
 		if conf.Operation == "install" {
 			savedConf.PackageManager = conf.PackageManager
 		}
+		if conf.Operation == "delete" {
+			savedConf.KeepLast = conf.KeepLast
+			savedConf.KeepWithin = conf.KeepWithin
+			savedConf.PerFile = conf.PerFile
+		}
 		if conf.Operation == "configure" {
 			savedConf.BuildFiles = conf.BuildFiles
+			savedConf.Shell = conf.Shell
+			savedConf.Managed = conf.Managed
 
-			if slices.Contains(conf.BuildFiles, ".zshrc") {
+			if config.HasShellRC(conf.BuildFiles) {
 				savedConf.SelectedPkgs = conf.SelectedPkgs
+				savedConf.Vars = conf.Vars
 			}
 
 			if slices.Contains(conf.BuildFiles, ".gitconfig") {
 				savedConf.GitName = conf.GitName
 				savedConf.GitEmail = conf.GitEmail
 				savedConf.GitBranch = conf.GitBranch
+				savedConf.GitSigning = conf.GitSigning
+				savedConf.GitSigningKey = conf.GitSigningKey
+				savedConf.GitExtras = conf.GitExtras
+				savedConf.GitTool = conf.GitTool
+				savedConf.GitIdentities = conf.GitIdentities
+				savedConf.GitMerge = conf.GitMerge
+			}
+
+			if slices.Contains(conf.BuildFiles, ".gitignore") {
+				savedConf.GitIgnore = conf.GitIgnore
+				savedConf.GitIgnorePatterns = conf.GitIgnorePatterns
 			}
 		}
 		savedConf.Save()
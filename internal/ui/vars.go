@@ -0,0 +1,38 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/huffmanks/stash/internal/config"
+	"github.com/huffmanks/stash/internal/setup"
+	"github.com/huffmanks/stash/internal/utils"
+	"github.com/yarlson/tap"
+)
+
+// promptVars asks for the variables the selected shell fragments use,
+// starting from the saved values or what was detected on this machine.
+func promptVars(ctx context.Context, conf, savedConf *config.Config) {
+	names, err := setup.ReferencedVars(conf, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		tap.Message(utils.Style(fmt.Sprintf("⚠️  [WARNING]: %v", err), "orange"))
+		return
+	}
+
+	defaults := setup.DefaultVars()
+	conf.Vars = map[string]string{}
+
+	for _, name := range names {
+		initial, ok := savedConf.Vars[name]
+		if !ok {
+			initial = defaults[name]
+		}
+
+		conf.Vars[name] = tap.Text(ctx, tap.TextOptions{
+			Message:      setup.VarMessage(name),
+			Placeholder:  defaults[name],
+			InitialValue: initial,
+		})
+	}
+}
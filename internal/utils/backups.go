@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/huffmanks/stash/internal/config"
+)
+
+const backupTimeLayout = "20060102_150405"
+
+// ParseBackup splits a backup file name such as bak_20060102_150405_.zshrc
+// into the file it belongs to and the time it was taken.
+func ParseBackup(name string) (file string, taken time.Time, ok bool) {
+	rest, found := strings.CutPrefix(name, "bak_")
+	if !found || len(rest) < len(backupTimeLayout)+2 {
+		return "", time.Time{}, false
+	}
+
+	taken, err := time.ParseInLocation(backupTimeLayout, rest[:len(backupTimeLayout)], time.Local)
+	if err != nil || rest[len(backupTimeLayout)] != '_' {
+		return "", time.Time{}, false
+	}
+
+	return strings.ReplaceAll(rest[len(backupTimeLayout)+1:], "%", "/"), taken, true
+}
+
+// ListBackups returns every backup in the stash dir, oldest first. Files
+// that match bak* but not the backup naming scheme are included with an
+// empty File so callers can still report or delete them.
+func ListBackups() ([]config.Backup, error) {
+	paths, err := FindBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]config.Backup, 0, len(paths))
+	for _, p := range paths {
+		b := config.Backup{Path: p}
+
+		if info, err := os.Stat(p); err == nil {
+			b.Size = info.Size()
+			b.Time = info.ModTime()
+		}
+
+		if file, taken, ok := ParseBackup(filepath.Base(p)); ok {
+			b.File = file
+			b.Time = taken
+		}
+
+		backups = append(backups, b)
+	}
+
+	slices.SortStableFunc(backups, func(a, b config.Backup) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return backups, nil
+}
+
+// GroupBackups groups backups by the file they belong to, keeping each
+// group oldest first. The returned keys are sorted.
+func GroupBackups(backups []config.Backup) ([]string, map[string][]config.Backup) {
+	groups := map[string][]config.Backup{}
+	for _, b := range backups {
+		groups[b.File] = append(groups[b.File], b)
+	}
+
+	files := make([]string, 0, len(groups))
+	for f := range groups {
+		files = append(files, f)
+	}
+	slices.Sort(files)
+
+	return files, groups
+}
+
+// FormatBackupTime renders a backup timestamp the way it appears in backup
+// file names, which is also what `--at` accepts.
+func FormatBackupTime(t time.Time) string {
+	return t.Format(backupTimeLayout)
+}
+
+// FormatSize renders a file size for display.
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// FindBackup returns the backup of file taken at the given timestamp, or
+// the most recent one when at is empty.
+func FindBackup(file, at string) (config.Backup, error) {
+	backups, err := ListBackups()
+	if err != nil {
+		return config.Backup{}, err
+	}
+
+	_, groups := GroupBackups(backups)
+	matches := groups[file]
+
+	if len(matches) == 0 {
+		return config.Backup{}, fmt.Errorf("no backups found for %s", file)
+	}
+
+	if at == "" {
+		return matches[len(matches)-1], nil
+	}
+
+	for _, b := range matches {
+		if FormatBackupTime(b.Time) == at {
+			return b, nil
+		}
+	}
+
+	return config.Backup{}, fmt.Errorf("no backup of %s taken at %s", file, at)
+}
+
+// ApplyRetention decides which backups the retention policy in c keeps. A
+// backup is kept when it is one of the newest KeepLast in its group or
+// younger than KeepWithin. Groups are per file when PerFile is set and span
+// all backups otherwise. Without a policy every backup is removed.
+func ApplyRetention(backups []config.Backup, c *config.Config, now time.Time) ([]config.BackupDecision, error) {
+	var within time.Duration
+	if c.KeepWithin != "" {
+		d, err := config.ParseAge(c.KeepWithin)
+		if err != nil {
+			return nil, err
+		}
+		within = d
+	}
+
+	// Rank each backup by age within its group, 0 being the newest.
+	rank := make([]int, len(backups))
+	seen := map[string]int{}
+	for i := len(backups) - 1; i >= 0; i-- {
+		key := ""
+		if c.PerFile {
+			key = backups[i].File
+		}
+		rank[i] = seen[key]
+		seen[key]++
+	}
+
+	scope := "overall"
+	decisions := make([]config.BackupDecision, len(backups))
+	for i, b := range backups {
+		d := config.BackupDecision{Backup: b}
+
+		if c.PerFile {
+			scope = "of " + b.File
+			if b.File == "" {
+				scope = "of unrecognized backups"
+			}
+		}
+
+		switch {
+		case c.KeepLast > 0 && rank[i] < c.KeepLast:
+			d.Keep = true
+			d.Reason = fmt.Sprintf("newest %d %s", c.KeepLast, scope)
+		case within > 0 && now.Sub(b.Time) < within:
+			d.Keep = true
+			d.Reason = fmt.Sprintf("newer than %s", c.KeepWithin)
+		case c.KeepLast > 0 && within > 0:
+			d.Reason = fmt.Sprintf("older than %s and not in newest %d %s", c.KeepWithin, c.KeepLast, scope)
+		case c.KeepLast > 0:
+			d.Reason = fmt.Sprintf("not in newest %d %s", c.KeepLast, scope)
+		case within > 0:
+			d.Reason = fmt.Sprintf("older than %s", c.KeepWithin)
+		}
+
+		decisions[i] = d
+	}
+
+	return decisions, nil
+}
@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// UnifiedDiff returns a unified diff turning a into b, labelled with the
+// given names, or "" when they are equal.
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	// Line numbers in a and b before each diff line.
+	aPos := make([]int, len(lines)+1)
+	bPos := make([]int, len(lines)+1)
+	var changes []int
+	for i, l := range lines {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if l.op != '+' {
+			aPos[i+1]++
+		}
+		if l.op != '-' {
+			bPos[i+1]++
+		}
+		if l.op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+
+	if len(changes) == 0 {
+		// Only the trailing newline differs.
+		changes = []int{len(lines) - 1}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	for i := 0; i < len(changes); {
+		start := max(changes[i]-diffContext, 0)
+		end := min(changes[i]+diffContext+1, len(lines))
+
+		for i++; i < len(changes) && changes[i]-diffContext <= end; i++ {
+			end = min(changes[i]+diffContext+1, len(lines))
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aPos[start], aPos[end]-aPos[start]),
+			hunkRange(bPos[start], bPos[end]-bPos[start]))
+
+		for _, l := range lines[start:end] {
+			out.WriteByte(l.op)
+			out.WriteString(l.text)
+			out.WriteByte('\n')
+		}
+	}
+
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return strconv.Itoa(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(b []byte) []string {
+	s := string(b)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines aligns a and b on their longest common subsequence. Dotfiles are
+// a few hundred lines at most, so the quadratic table is fine; anything much
+// larger is shown as a full replacement.
+func diffLines(a, b []string) []diffLine {
+	if len(a)*len(b) > 4_000_000 {
+		lines := make([]diffLine, 0, len(a)+len(b))
+		for _, l := range a {
+			lines = append(lines, diffLine{'-', l})
+		}
+		for _, l := range b {
+			lines = append(lines, diffLine{'+', l})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+
+	return lines
+}
+
+// ColorDiff colors a unified diff for the terminal.
+func ColorDiff(diff string) string {
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for i, l := range lines {
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			lines[i] = Style(l, "bold")
+		case strings.HasPrefix(l, "@@"):
+			lines[i] = Style(l, "cyan")
+		case strings.HasPrefix(l, "+"):
+			lines[i] = Style(l, "green")
+		case strings.HasPrefix(l, "-"):
+			lines[i] = Style(l, "red")
+		default:
+			lines[i] = Style(l, "dim")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Page shows text through $PAGER (less -R by default) when it does not fit
+// on the terminal. It returns false when the text was not paged and the
+// caller should print it itself.
+func Page(text string) bool {
+	if !Interactive || strings.Count(text, "\n")+1 < terminalRows()-6 {
+		return false
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		if !CommandExists("less") {
+			return false
+		}
+		pager = "less -R"
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(text + "\n")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run() == nil
+}
+
+func terminalRows() int {
+	if rows, err := strconv.Atoi(os.Getenv("LINES")); err == nil && rows > 0 {
+		return rows
+	}
+
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	if out, err := cmd.Output(); err == nil {
+		if fields := strings.Fields(string(out)); len(fields) == 2 {
+			if rows, err := strconv.Atoi(fields[0]); err == nil && rows > 0 {
+				return rows
+			}
+		}
+	}
+
+	return 24
+}
+
+// EditContent opens content in $VISUAL or $EDITOR (vi by default) and
+// returns what was saved.
+func EditContent(name string, content []byte) ([]byte, error) {
+	tmp, err := os.CreateTemp("", "stash-*-"+strings.TrimPrefix(filepath.Base(name), "."))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", tmp.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w", editor, err)
+	}
+
+	return os.ReadFile(tmp.Name())
+}
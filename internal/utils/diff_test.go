@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line with context",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n",
+			want: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "new file",
+			a:    "",
+			b:    "x\ny\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name: "removed file",
+			a:    "x\n",
+			b:    "",
+			want: "--- a\n+++ b\n@@ -1 +0,0 @@\n-x\n",
+		},
+		{
+			name: "distant changes get separate hunks",
+			a:    "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			b:    "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("a", "b", []byte(tt.a), []byte(tt.b)); got != tt.want {
+				t.Errorf("UnifiedDiff\n got: %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffOnlyTrailingNewline(t *testing.T) {
+	if got := UnifiedDiff("a", "b", []byte("x\n"), []byte("x")); got == "" {
+		t.Error("UnifiedDiff of files differing only in the trailing newline is empty")
+	}
+}
+
+// TestUnifiedDiffApplies checks the diffs against patch, which is strict
+// about hunk headers.
+func TestUnifiedDiffApplies(t *testing.T) {
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch not installed")
+	}
+
+	var a, b []string
+	for i := range 40 {
+		a = append(a, fmt.Sprintf("line %d", i))
+		switch {
+		case i%11 == 0:
+			b = append(b, fmt.Sprintf("changed %d", i))
+		case i%7 == 0:
+		default:
+			b = append(b, a[i])
+		}
+		if i%13 == 0 {
+			b = append(b, fmt.Sprintf("inserted %d", i))
+		}
+	}
+	before := strings.Join(a, "\n") + "\n"
+	after := strings.Join(b, "\n") + "\n"
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte(before), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("patch", "--quiet", file)
+	cmd.Stdin = strings.NewReader(UnifiedDiff("file", "file", []byte(before), []byte(after)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("patch: %v\n%s", err, out)
+	}
+
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != after {
+		t.Errorf("patched file\n got: %q\nwant: %q", got, after)
+	}
+}
@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ReleaseAPI is the GitHub API for the stash repository. STASH_RELEASE_API
+// points stash at another server, e.g. a mirror or a test server.
+const ReleaseAPI = "https://api.github.com/repos/huffmanks/stash"
+
+// Release is a GitHub release and the assets goreleaser uploaded to it.
+type Release struct {
+	Tag        string         `json:"tag_name"`
+	Prerelease bool           `json:"prerelease"`
+	Assets     []ReleaseAsset `json:"assets"`
+}
+
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Asset returns the asset called name.
+func (r *Release) Asset(name string) (ReleaseAsset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return ReleaseAsset{}, false
+}
+
+// ReleaseClient talks to the release API at API.
+type ReleaseClient struct {
+	API  string
+	HTTP *http.Client
+}
+
+func NewReleaseClient() *ReleaseClient {
+	api := ReleaseAPI
+	if env := os.Getenv("STASH_RELEASE_API"); env != "" {
+		api = strings.TrimRight(env, "/")
+	}
+	return &ReleaseClient{API: api, HTTP: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// Tag returns the release tagged tag. A version without the leading v is
+// accepted too.
+func (rc *ReleaseClient) Tag(ctx context.Context, tag string) (*Release, error) {
+	var r Release
+	err := rc.getJSON(ctx, rc.API+"/releases/tags/"+tag, &r)
+	if err != nil && !strings.HasPrefix(tag, "v") {
+		if rc.getJSON(ctx, rc.API+"/releases/tags/v"+tag, &r) == nil {
+			return &r, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Latest returns the newest release that is not a prerelease.
+func (rc *ReleaseClient) Latest(ctx context.Context) (*Release, error) {
+	var r Release
+	if err := rc.getJSON(ctx, rc.API+"/releases/latest", &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// LatestFor returns the newest release on channel. On the prerelease
+// channel that is the newest published release of any kind.
+func (rc *ReleaseClient) LatestFor(ctx context.Context, channel string) (*Release, error) {
+	if channel != "prerelease" {
+		return rc.Latest(ctx)
+	}
+
+	var releases []Release
+	if err := rc.getJSON(ctx, rc.API+"/releases?per_page=20", &releases); err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return nil, errors.New("no releases found")
+	}
+	return &releases[0], nil
+}
+
+func (rc *ReleaseClient) getJSON(ctx context.Context, url string, v any) error {
+	data, err := rc.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", url, err)
+	}
+	return nil
+}
+
+func (rc *ReleaseClient) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "stash")
+
+	resp, err := rc.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// AssetName is the archive goreleaser builds for version on goos/arch, see
+// the archives name_template in .goreleaser.yaml.
+func AssetName(version, goos, arch string) string {
+	return fmt.Sprintf("stash_%s_%s_%s.tar.gz", strings.TrimPrefix(version, "v"), goos, arch)
+}
+
+// DownloadBinary fetches the archive of r for goos/arch, checks it against
+// the release's checksums file and returns the stash binary inside it.
+func (rc *ReleaseClient) DownloadBinary(ctx context.Context, r *Release, goos, arch string) ([]byte, error) {
+	name := AssetName(r.Tag, goos, arch)
+
+	asset, ok := r.Asset(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s", r.Tag, name)
+	}
+
+	var sums ReleaseAsset
+	for _, a := range r.Assets {
+		// goreleaser names it checksums.txt or <project>_<version>_checksums.txt.
+		if strings.HasSuffix(a.Name, "checksums.txt") {
+			sums = a
+			break
+		}
+	}
+	if sums.URL == "" {
+		return nil, fmt.Errorf("release %s has no checksums.txt", r.Tag)
+	}
+
+	sumData, err := rc.get(ctx, sums.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	want, ok := findChecksum(sumData, name)
+	if !ok {
+		return nil, fmt.Errorf("%s does not list %s", sums.Name, name)
+	}
+
+	archive, err := rc.get(ctx, asset.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	got := sha256.Sum256(archive)
+	if hex.EncodeToString(got[:]) != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %x, want %s", name, got, want)
+	}
+
+	return extractBinary(archive, "stash")
+}
+
+// findChecksum looks up name in a sha256sum style file.
+func findChecksum(data []byte, name string) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+	return "", false
+}
+
+// extractBinary returns the file called name from a .tar.gz archive.
+func extractBinary(archive []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive has no %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// ExecutablePath is the path of the running stash binary, with symlinks
+// resolved.
+func ExecutablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// DirWritable reports whether files can be created in dir without root,
+// e.g. ~/.local/bin as opposed to /usr/local/bin.
+func DirWritable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".stash-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// SwapBinary replaces the binary at target with data. The new binary is
+// written next to target and renamed over it, so target is never left half
+// written. Only when the directory is not writable is the same done
+// through sudo.
+func SwapBinary(target string, data []byte) error {
+	dir := filepath.Dir(target)
+	if !DirWritable(dir) {
+		return swapBinarySudo(target, data)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".stash-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func swapBinarySudo(target string, data []byte) error {
+	tmp, err := os.CreateTemp("", "stash-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	PromptForSudo("❌ [ERROR]: sudo authentication failed.", "true", true)
+
+	// Copy into the target's directory first so the final mv is a rename.
+	script := `install -m 0755 "$1" "$2.new" && mv -f "$2.new" "$2"`
+	cmd := exec.Command("sudo", "sh", "-c", script, "sh", tmp.Name(), target)
+	if os.Geteuid() == 0 {
+		cmd = exec.Command("sh", "-c", script, "sh", tmp.Name(), target)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tarGz builds a .tar.gz archive holding files.
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// releaseServer serves release v1.2.3 for linux/amd64 the way GitHub and
+// goreleaser lay it out. files maps asset names to their content; a nil
+// value leaves the asset out of the release.
+func releaseServer(t *testing.T, files map[string][]byte) *ReleaseClient {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	r := Release{Tag: "v1.2.3"}
+	for name, content := range files {
+		if content == nil {
+			continue
+		}
+		r.Assets = append(r.Assets, ReleaseAsset{Name: name, URL: srv.URL + "/download/" + name})
+		mux.HandleFunc("/download/"+name, func(w http.ResponseWriter, _ *http.Request) {
+			w.Write(content)
+		})
+	}
+
+	mux.HandleFunc("/releases/tags/v1.2.3", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(r)
+	})
+
+	return &ReleaseClient{API: srv.URL, HTTP: srv.Client()}
+}
+
+func checksums(archive []byte, name string) []byte {
+	return fmt.Appendf(nil, "%x  %s\n", sha256.Sum256(archive), name)
+}
+
+func TestDownloadBinary(t *testing.T) {
+	name := AssetName("v1.2.3", "linux", "amd64")
+	archive := tarGz(t, map[string]string{"readme.md": "docs", "stash": "new binary"})
+	other := tarGz(t, map[string]string{"stash": "tampered"})
+
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "happy path",
+			files: map[string][]byte{name: archive, "stash_1.2.3_checksums.txt": checksums(archive, name)},
+			want:  "new binary",
+		},
+		{
+			name:    "checksum mismatch",
+			files:   map[string][]byte{name: other, "checksums.txt": checksums(archive, name)},
+			wantErr: "checksum mismatch",
+		},
+		{
+			name:    "missing asset",
+			files:   map[string][]byte{"checksums.txt": checksums(archive, name)},
+			wantErr: "has no " + name,
+		},
+		{
+			name:    "missing checksums file",
+			files:   map[string][]byte{name: archive},
+			wantErr: "has no checksums.txt",
+		},
+		{
+			name:    "asset not in checksums file",
+			files:   map[string][]byte{name: archive, "checksums.txt": checksums(archive, "other.tar.gz")},
+			wantErr: "does not list " + name,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := releaseServer(t, tt.files)
+
+			r, err := client.Tag(context.Background(), "1.2.3")
+			if err != nil {
+				t.Fatalf("Tag: %v", err)
+			}
+
+			got, err := client.DownloadBinary(context.Background(), r, "linux", "amd64")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("DownloadBinary error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadBinary: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("DownloadBinary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractBinary(t *testing.T) {
+	got, err := extractBinary(tarGz(t, map[string]string{"stash_1.2.3/stash": "binary"}), "stash")
+	if err != nil || string(got) != "binary" {
+		t.Errorf("extractBinary nested = %q, %v, want %q", got, err, "binary")
+	}
+
+	_, err = extractBinary(tarGz(t, map[string]string{"readme.md": "docs", "stash.sig": "sig"}), "stash")
+	if err == nil || !strings.Contains(err.Error(), "archive has no stash") {
+		t.Errorf("extractBinary without stash error = %v, want archive has no stash", err)
+	}
+
+	if _, err := extractBinary([]byte("not a gzip"), "stash"); err == nil {
+		t.Error("extractBinary of a non gzip archive: want an error")
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BinDir is where the binaries replaced by an update are kept, named
+// stash.<version>.
+func BinDir() string {
+	return filepath.Join(StashDir(), "bin")
+}
+
+// KeptBinary is a previous stash binary in BinDir.
+type KeptBinary struct {
+	Version string
+	Path    string
+	ModTime time.Time
+}
+
+// KeptBinaries lists the binaries in BinDir, newest first.
+func KeptBinaries() ([]KeptBinary, error) {
+	entries, err := os.ReadDir(BinDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []KeptBinary
+	for _, entry := range entries {
+		version, ok := strings.CutPrefix(entry.Name(), "stash.")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		kept = append(kept, KeptBinary{Version: version, Path: filepath.Join(BinDir(), entry.Name()), ModTime: info.ModTime()})
+	}
+
+	slices.SortFunc(kept, func(a, b KeptBinary) int { return b.ModTime.Compare(a.ModTime) })
+	return kept, nil
+}
+
+// FindKeptBinary returns the binary kept for version, with or without the
+// leading v.
+func FindKeptBinary(version string) (KeptBinary, bool) {
+	kept, _ := KeptBinaries()
+	for _, k := range kept {
+		if sameVersion(k.Version, version) {
+			return k, true
+		}
+	}
+	return KeptBinary{}, false
+}
+
+// KeepBinary copies the binary at target to BinDir as stash.<version>
+// before it is replaced.
+func KeepBinary(target, version string) error {
+	src, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(BinDir(), 0755); err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(filepath.Join(BinDir(), "stash."+version), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	// Touch it so the newest kept binary is the one just replaced.
+	now := time.Now()
+	return os.Chtimes(dst.Name(), now, now)
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/huffmanks/stash/internal/config"
+)
+
+// SigningKeys lists the keys on this machine that commits can be signed
+// with in format: the public keys in ~/.ssh for ssh, the secret keys in the
+// gpg keyring for gpg.
+func SigningKeys(format string) []config.SigningKey {
+	switch format {
+	case "ssh":
+		return sshPublicKeys()
+	case "gpg":
+		return gpgSecretKeys()
+	}
+	return nil
+}
+
+func sshPublicKeys() []config.SigningKey {
+	paths, _ := filepath.Glob(HomePath(".ssh/*.pub"))
+
+	var keys []config.SigningKey
+	for _, p := range paths {
+		label := TildePath(p)
+		if data, err := os.ReadFile(p); err == nil {
+			// The comment after the key type and key is usually an email.
+			if fields := strings.Fields(string(data)); len(fields) > 2 {
+				label += " (" + strings.Join(fields[2:], " ") + ")"
+			}
+		}
+		keys = append(keys, config.SigningKey{Key: p, Label: label})
+	}
+
+	return keys
+}
+
+func gpgSecretKeys() []config.SigningKey {
+	if !CommandExists("gpg") {
+		return nil
+	}
+
+	out, err := exec.Command("gpg", "--list-secret-keys", "--keyid-format=long", "--with-colons").Output()
+	if err != nil {
+		return nil
+	}
+
+	var keys []config.SigningKey
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+
+		switch fields[0] {
+		case "sec":
+			keys = append(keys, config.SigningKey{Key: fields[4], Label: fields[4]})
+		case "uid":
+			// Label each key with its first user ID.
+			if n := len(keys); n > 0 && keys[n-1].Label == keys[n-1].Key {
+				keys[n-1].Label += " (" + fields[9] + ")"
+			}
+		}
+	}
+
+	return keys
+}
@@ -1,60 +1,29 @@
 package utils
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"time"
-
-	"github.com/yarlson/tap"
+	"path/filepath"
 )
 
-func HandleUninstall(banner string) {
-	ctx := context.Background()
-
-	tap.Intro(banner)
-
-	var initialValue *string
-	var noValue = "no"
-
-	initialValue = &noValue
-
-	confirmed := tap.Select(ctx, tap.SelectOptions[string]{
-		Message:      "Are you sure you want to uninstall?",
-		InitialValue: initialValue,
-		Options: []tap.SelectOption[string]{
-			{Value: "yes", Label: "Yes", Hint: "Requires root privileges"},
-			{Value: "no", Label: "No"},
-		},
-	})
+// BinaryNeedsRoot reports whether removing or replacing the binary at path
+// needs sudo: only when its directory, such as /usr/local/bin, is not
+// writable, never for ~/.local/bin.
+func BinaryNeedsRoot(path string) bool {
+	return !DirWritable(filepath.Dir(path))
+}
 
-	if confirmed == "no" {
-		tap.Outro(Style("🛑 [ABORTED]: stash remains installed.", "orange"))
-		os.Exit(0)
+// RemoveBinary deletes the stash binary at path, through sudo when its
+// directory is not writable. errorMsg is shown if sudo fails.
+func RemoveBinary(path, errorMsg string) error {
+	if !BinaryNeedsRoot(path) {
+		return os.Remove(path)
 	}
 
-	binaryPath := "/usr/local/bin/stash"
+	PromptForSudo(errorMsg, fmt.Sprintf("rm '%s'", path))
 
-	if _, err := os.Stat(binaryPath); os.IsNotExist(err) {
-		tap.Outro(Style("🛑 [ABORTED]: stash is not found in /usr/local/bin.", "orange"))
-		os.Exit(0)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s is still there", path)
 	}
-
-	errorMsg := fmt.Sprintf("❌ %s\n   %s\n      %s\n      %s", Style("[ERROR]: Failed to remove the binary.", "red"), Style("To finish the cleanup, you can manually remove:", "dim"), Style("• /usr/local/bin/stash", "cyan"), Style("• ~/.config/stash", "cyan"))
-	command := fmt.Sprintf("rm %s", binaryPath)
-	PromptForSudo(errorMsg, command)
-
-	spinner := tap.NewSpinner(tap.SpinnerOptions{
-		Delay: time.Millisecond * 100,
-	})
-
-	spinner.Start("Uninstalling stash...")
-	time.Sleep(time.Millisecond * 1000)
-
-	spinner.Stop("Uninstalling stash...", 0)
-	time.Sleep(time.Millisecond * 100)
-
-	tap.Outro("✅ [UNINSTALLED]: stash has been removed successfully.")
-	time.Sleep(time.Millisecond * 100)
-	os.Exit(0)
+	return nil
 }
@@ -4,19 +4,66 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"runtime"
+	"strings"
 	"time"
 
+	"github.com/huffmanks/stash/internal/config"
 	"github.com/yarlson/tap"
 )
 
-func HandleUpdate(banner string, force bool, latest string) {
+// HandleUpdate replaces the running binary with the latest release on
+// channel, or the release tagged to when it is set. A version kept in BinDir
+// is used for to without a download, so going back works offline. Otherwise
+// the archive is checked against the release's checksums before anything on
+// disk is touched, and the binary it replaces is kept in BinDir for
+// --rollback.
+func HandleUpdate(banner string, force bool, to, channel string) {
 	ctx := context.Background()
 
 	tap.Intro(banner)
 
+	if to != "" && !force && sameVersion(to, config.Version) {
+		tap.Outro(fmt.Sprintf("✅ [UP TO DATE]: stash %s is already installed.", config.Version))
+		os.Exit(0)
+	}
+
+	if to != "" {
+		if k, ok := FindKeptBinary(to); ok {
+			useKept(ctx, k, !force, "Switch to version: [%s]?", "✅ [UPDATED]: to kept version [%s]")
+		}
+	}
+
+	spinner := tap.NewSpinner(tap.SpinnerOptions{
+		Delay: time.Millisecond * 100,
+	})
+
+	client := NewReleaseClient()
+	var release *Release
+	var err error
+
+	if to != "" {
+		spinner.Start(fmt.Sprintf("Looking up release %s...", to))
+		release, err = client.Tag(ctx, to)
+	} else {
+		spinner.Start(fmt.Sprintf("Checking for the latest %s release...", channel))
+		release, err = client.LatestFor(ctx, channel)
+	}
+
+	if err != nil {
+		spinner.Stop(fmt.Sprintf("❌ [FAILED]: looking up the release: %v", err), 2)
+		time.Sleep(time.Millisecond * 100)
+		os.Exit(1)
+	}
+	spinner.Stop(fmt.Sprintf("Release: [%s]", Style(release.Tag, "bold", "cyan")), 0)
+
+	if !force && sameVersion(release.Tag, config.Version) {
+		tap.Outro(fmt.Sprintf("✅ [UP TO DATE]: stash %s is already installed.", release.Tag))
+		os.Exit(0)
+	}
+
 	if !force {
-		msg := fmt.Sprintf("Update to version: [%s]?", Style(latest, "bold", "cyan"))
+		msg := fmt.Sprintf("Update to version: [%s]?", Style(release.Tag, "bold", "cyan"))
 		confirmed := tap.Confirm(ctx, tap.ConfirmOptions{
 			Message:      msg,
 			InitialValue: false,
@@ -28,36 +75,145 @@ func HandleUpdate(banner string, force bool, latest string) {
 		}
 	}
 
-	PromptForSudo("❌ [ERROR]: sudo authentication failed.", "true", true)
+	target := executableOrExit()
 
-	spinner := tap.NewSpinner(tap.SpinnerOptions{
+	spinner = tap.NewSpinner(tap.SpinnerOptions{
 		Delay: time.Millisecond * 100,
 	})
-	spinner.Start("Updating...")
+	spinner.Start(fmt.Sprintf("Downloading %s...", AssetName(release.Tag, runtime.GOOS, runtime.GOARCH)))
+
+	binary, err := client.DownloadBinary(ctx, release, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		spinner.Stop(fmt.Sprintf("❌ [FAILED]: downloading stash: %v", err), 2)
+		time.Sleep(time.Millisecond * 100)
+		os.Exit(1)
+	}
+	spinner.Stop("✅ [VERIFIED]: checksum matches.", 0)
 	time.Sleep(time.Millisecond * 100)
 
-	scriptURL := "https://raw.githubusercontent.com/huffmanks/stash/main/install.sh"
-	shellCmd := fmt.Sprintf("curl -sSL %s | bash -s --", scriptURL)
+	replaceBinary(target, binary)
+
+	tap.Outro(fmt.Sprintf("✅ [UPDATED]: successfully to version [%s]", release.Tag))
+	time.Sleep(time.Millisecond * 100)
+
+	os.Exit(0)
+}
+
+// HandleRollback puts back the binary the last update replaced. The
+// running binary is kept in turn, so an update can be rolled forward again
+// with --to.
+func HandleRollback(banner string) {
+	ctx := context.Background()
 
-	if force {
-		shellCmd += " --force"
+	tap.Intro(banner)
+
+	kept, err := KeptBinaries()
+	if err != nil {
+		tap.Outro(Style(fmt.Sprintf("❌ [ERROR]: reading %s: %v", TildePath(BinDir()), err), "red"))
+		os.Exit(1)
+	}
+
+	var previous *KeptBinary
+	for i := range kept {
+		if !sameVersion(kept[i].Version, config.Version) {
+			previous = &kept[i]
+			break
+		}
 	}
 
-	cmd := exec.Command("sh", "-c", shellCmd)
-	err := cmd.Run()
+	if previous == nil {
+		tap.Outro(Style("🛑 [ABORTED]: no previous version to roll back to.", "orange"))
+		os.Exit(0)
+	}
+
+	useKept(ctx, *previous, true, "Roll back to version: [%s]?", "✅ [ROLLED BACK]: to version [%s]")
+}
 
+// useKept swaps in the kept binary k, asking first when ask is set, and
+// exits. question and done are formats for k's version.
+func useKept(ctx context.Context, k KeptBinary, ask bool, question, done string) {
+	if ask {
+		confirmed := tap.Confirm(ctx, tap.ConfirmOptions{
+			Message:      fmt.Sprintf(question, Style(k.Version, "bold", "cyan")),
+			InitialValue: false,
+		})
+
+		if !confirmed {
+			tap.Outro(Style("🛑 [ABORTED]: stash remains installed.", "orange"))
+			os.Exit(0)
+		}
+	}
+
+	binary, err := os.ReadFile(k.Path)
 	if err != nil {
-		spinner.Stop("❌ [FAILED]: updating stash.", 2)
-		time.Sleep(time.Millisecond * 100)
+		tap.Outro(Style(fmt.Sprintf("❌ [ERROR]: reading %s: %v", TildePath(k.Path), err), "red"))
 		os.Exit(1)
 	}
 
-	time.Sleep(time.Millisecond * 1000)
-	spinner.Stop("Updating...", 0)
+	replaceBinary(executableOrExit(), binary)
 
+	tap.Outro(fmt.Sprintf(done, k.Version))
 	time.Sleep(time.Millisecond * 100)
-	tap.Outro(fmt.Sprintf("✅ [UPDATED]: successfully to version [%s]", latest))
+
+	os.Exit(0)
+}
+
+// HandleUpdateList shows the versions kept in BinDir that --rollback and
+// --to can go back to without a download.
+func HandleUpdateList(banner string) {
+	tap.Intro(banner)
+
+	kept, err := KeptBinaries()
+	if err != nil {
+		tap.Outro(Style(fmt.Sprintf("❌ [ERROR]: reading %s: %v", TildePath(BinDir()), err), "red"))
+		os.Exit(1)
+	}
+
+	if len(kept) == 0 {
+		tap.Outro(Style(fmt.Sprintf("No previous versions in %s.", TildePath(BinDir())), "dim"))
+		os.Exit(0)
+	}
+
+	var lines []string
+	for _, k := range kept {
+		line := fmt.Sprintf("%s %s", Style(k.Version, "bold", "cyan"), Style(k.ModTime.Format("2006-01-02 15:04"), "dim"))
+		if sameVersion(k.Version, config.Version) {
+			line += Style(" (current)", "green")
+		}
+		lines = append(lines, "   "+line)
+	}
+
+	tap.Message(fmt.Sprintf("📦 [VERSIONS]: %s\n\n%s", TildePath(BinDir()), strings.Join(lines, "\n")))
 	time.Sleep(time.Millisecond * 100)
 
+	tap.Outro(fmt.Sprintf("Current version: [%s]", Style(config.Version, "bold", "green")))
 	os.Exit(0)
 }
+
+func executableOrExit() string {
+	target, err := ExecutablePath()
+	if err != nil {
+		tap.Outro(Style(fmt.Sprintf("❌ [ERROR]: finding the stash binary: %v", err), "red"))
+		os.Exit(1)
+	}
+	return target
+}
+
+// replaceBinary keeps the binary at target in BinDir under the running
+// version and swaps binary in.
+func replaceBinary(target string, binary []byte) {
+	if err := KeepBinary(target, config.Version); err != nil {
+		tap.Message(Style(fmt.Sprintf("⚠️  [WARNING]: could not keep the current binary for rollback: %v", err), "orange"))
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if err := SwapBinary(target, binary); err != nil {
+		tap.Outro(Style(fmt.Sprintf("❌ [FAILED]: replacing %s: %v", TildePath(target), err), "red"))
+		os.Exit(1)
+	}
+	time.Sleep(time.Millisecond * 100)
+}
+
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
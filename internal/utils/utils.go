@@ -1,13 +1,14 @@
 package utils
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +16,32 @@ import (
 	"github.com/yarlson/tap"
 )
 
+// Interactive is false when stash runs without a TTY (e.g. `stash apply`),
+// in which case nothing may block on user input.
+var Interactive = true
+
+// StderrWriter sends tap output to stderr so stdout stays free for
+// machine-readable output.
+type StderrWriter struct{}
+
+func (w StderrWriter) Write(p []byte) (int, error) {
+	return os.Stderr.Write(p)
+}
+
+func (w StderrWriter) On(event string, handler func()) {}
+
+func (w StderrWriter) Emit(event string) {}
+
+// DetectShell returns the shell from $SHELL when stash can build for it,
+// and zsh otherwise.
+func DetectShell() string {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	if slices.Contains(config.Shells, shell) {
+		return shell
+	}
+	return "zsh"
+}
+
 func DetectPackageManager() string {
 	switch runtime.GOOS {
 	case "darwin":
@@ -24,6 +51,9 @@ func DetectPackageManager() string {
 		if _, err := exec.LookPath("port"); err == nil {
 			return "macports"
 		}
+		if _, err := exec.LookPath("nix-env"); err == nil {
+			return "nix"
+		}
 
 	case "linux":
 		managers := []struct {
@@ -33,6 +63,10 @@ func DetectPackageManager() string {
 			{"apt", "apt-get"},
 			{"pacman", "pacman"},
 			{"dnf", "dnf"},
+			{"zypper", "zypper"},
+			{"apk", "apk"},
+			{"xbps", "xbps-install"},
+			{"nix", "nix-env"},
 		}
 
 		for _, pm := range managers {
@@ -54,7 +88,9 @@ func RunCmd(shellCmd string, dryRun bool, progress *tap.Progress) error {
 		return nil
 	}
 
-	if strings.Contains(shellCmd, "sudo") {
+	shellCmd = adaptSudo(shellCmd)
+
+	if sudoCmd.MatchString(shellCmd) {
 		PromptForSudo("❌ [ERROR]: sudo authentication failed.", "true", true)
 	}
 
@@ -96,45 +132,100 @@ func RunCmd(shellCmd string, dryRun bool, progress *tap.Progress) error {
 	return nil
 }
 
-func WriteFiles(fileName string, content []byte, dryRun bool, spinner *tap.Spinner) error {
+// StashDir is where stash keeps its config and backups.
+func StashDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "stash")
+}
+
+func HomePath(fileName string) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, fileName)
+}
+
+// TargetPath returns where a build target is written. Every target but the
+// VS Code settings is a path relative to $HOME.
+func TargetPath(file string) string {
+	if file != config.VSCodeSettings {
+		return HomePath(file)
+	}
+
+	if runtime.GOOS == "darwin" {
+		return HomePath("Library/Application Support/Code/User/settings.json")
+	}
+
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "Code", "User", "settings.json")
+	}
+
+	return HomePath(".config/Code/User/settings.json")
+}
 
+// TildePath shortens paths under the home directory for display.
+func TildePath(p string) string {
 	home, _ := os.UserHomeDir()
-	finalPath := filepath.Join(home, fileName)
+	if home != "" && strings.HasPrefix(p, home+string(filepath.Separator)) {
+		return "~" + strings.TrimPrefix(p, home)
+	}
+	return p
+}
+
+// BackupPath returns where an existing file is moved before it is replaced,
+// e.g. ~/.config/stash/bak_20060102_150405_.zshrc. Slashes in nested
+// targets such as .config/fish/config.fish are stored as %.
+func BackupPath(fileName string, t time.Time) string {
+	timestamp := t.Format("20060102_150405")
+	return filepath.Join(StashDir(), fmt.Sprintf("bak_%s_%s", timestamp, strings.ReplaceAll(fileName, "/", "%")))
+}
 
+func BackupFile(finalPath, bakPath string, dryRun bool, spinner *tap.Spinner) error {
 	if dryRun {
-		finalPath = filepath.Join(home, "test_"+fileName)
-		msg := fmt.Sprintf(Style("___ [DRY_RUN]: Writing test file to: %s  ___", "orange"), finalPath)
+		msg := fmt.Sprintf(Style("___ [DRY_RUN]: Would move existing file to: %s ___", "orange"), bakPath)
 		spinner.Message(msg)
 		time.Sleep(time.Millisecond * 100)
-	} else {
-		if _, err := os.Stat(finalPath); err == nil {
-			now := time.Now()
-			timestamp := now.Format("20060102_150405")
-
-			bakDir := filepath.Join(home, ".config", "stash")
-			if err := os.MkdirAll(bakDir, 0755); err != nil {
-				spinner.Message(fmt.Sprintf("❌ [ERROR]: Could not create backup dir: %v", err))
-				time.Sleep(time.Millisecond * 100)
-			}
+		return nil
+	}
 
-			bakFileName := fmt.Sprintf("bak_%s_%s", timestamp, fileName)
-			bakPath := filepath.Join(bakDir, bakFileName)
-
-			if err := os.Rename(finalPath, bakPath); err == nil {
-				os.Chtimes(bakPath, now, now)
-				msg := fmt.Sprintf("🚚 [MOVED]: Existing file moved to %s", bakPath)
-				spinner.Message(msg)
-				time.Sleep(time.Millisecond * 100)
-			} else {
-				msg := fmt.Sprintf("⚠️ %s %v", Style("[WARNING]: Could not backup existing file:", "orange"), err)
-				spinner.Message(msg)
-				time.Sleep(time.Millisecond * 100)
-			}
-		}
+	if _, err := os.Stat(finalPath); err != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(bakPath), 0755); err != nil {
+		spinner.Message(fmt.Sprintf("❌ [ERROR]: Could not create backup dir: %v", err))
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if err := os.Rename(finalPath, bakPath); err != nil {
+		msg := fmt.Sprintf("⚠️ %s %v", Style("[WARNING]: Could not backup existing file:", "orange"), err)
+		spinner.Message(msg)
+		time.Sleep(time.Millisecond * 100)
+		return err
+	}
+
+	now := time.Now()
+	os.Chtimes(bakPath, now, now)
+	msg := fmt.Sprintf("🚚 [MOVED]: Existing file moved to %s", bakPath)
+	spinner.Message(msg)
+	time.Sleep(time.Millisecond * 100)
+
+	return nil
+}
 
-		msg := fmt.Sprintf("📝 [WRITING]: file to %s", finalPath)
+// WriteTarget writes content to finalPath. Dry runs only report the write.
+func WriteTarget(finalPath string, content []byte, dryRun bool, spinner *tap.Spinner) error {
+	if dryRun {
+		msg := fmt.Sprintf(Style("___ [DRY_RUN]: Would write: %s ___", "orange"), finalPath)
 		spinner.Message(msg)
 		time.Sleep(time.Millisecond * 100)
+		return nil
+	}
+
+	msg := fmt.Sprintf("📝 [WRITING]: file to %s", finalPath)
+	spinner.Message(msg)
+	time.Sleep(time.Millisecond * 100)
+
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		return err
 	}
 
 	err := os.WriteFile(finalPath, content, 0644)
@@ -148,20 +239,13 @@ func WriteFiles(fileName string, content []byte, dryRun bool, spinner *tap.Spinn
 	return nil
 }
 
-func DeleteFiles(dryRun bool, spinner *tap.Spinner) config.DeleteResult {
-	home, _ := os.UserHomeDir()
-	stashDir := filepath.Join(home, ".config", "stash")
-	pattern := filepath.Join(stashDir, "bak*")
+func FindBackups() ([]string, error) {
+	return filepath.Glob(filepath.Join(StashDir(), "bak*"))
+}
 
+func DeleteFiles(files []string, dryRun bool, spinner *tap.Spinner) config.DeleteResult {
 	res := config.DeleteResult{}
 
-	files, err := filepath.Glob(pattern)
-	if err != nil {
-		spinner.Message(fmt.Sprintf("❌ [ERROR]: Glob pattern failed: %v", err))
-		time.Sleep(time.Millisecond * 100)
-		return res
-	}
-
 	if len(files) == 0 {
 		spinner.Message("‼️ [EMPTY]: No backup files found to delete.")
 		time.Sleep(time.Millisecond * 100)
@@ -194,29 +278,32 @@ func DeleteFiles(dryRun bool, spinner *tap.Spinner) config.DeleteResult {
 	return res
 }
 
-var pkgOverrides = map[string]map[string]string{
-	"fd": {
-		"apt": "fd-find",
-		"dnf": "fd-find",
-	},
-	"java-android-studio": {
-		"homebrew": "--cask zulu@17",
-		"macports": "openjdk17-zulu",
-	},
+func CommandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
 }
 
-func ResolvePkgName(pm, pkg string) string {
-	if overrides, found := pkgOverrides[pkg]; found {
-		if specificName, ok := overrides[pm]; ok {
-			return specificName
-		}
-	}
-	return pkg
+// sudoCmd matches sudo where it runs as a command: at the start of the
+// command or after a newline, ;, &&, || or |, or inside $(...).
+var sudoCmd = regexp.MustCompile(`(^|[\n;&|(])([ \t]*)sudo[ \t]+`)
+
+// adaptSudo drops sudo when already running as root (containers often have
+// no sudo at all) and makes it fail fast instead of asking for a password
+// when running non-interactively.
+func adaptSudo(shellCmd string) string {
+	return adaptSudoAs(shellCmd, os.Geteuid() == 0, Interactive)
 }
 
-func CommandExists(name string) bool {
-	_, err := exec.LookPath(name)
-	return err == nil
+func adaptSudoAs(shellCmd string, root, interactive bool) string {
+	if root {
+		return sudoCmd.ReplaceAllString(shellCmd, "$1$2")
+	}
+
+	if !interactive {
+		return sudoCmd.ReplaceAllString(shellCmd, "${1}${2}sudo -n ")
+	}
+
+	return shellCmd
 }
 
 func hasSudoPrivilege() bool {
@@ -234,6 +321,22 @@ func PromptForSudo(errorMsg string, command string, useSkipCmd ...bool) {
 
 	time.Sleep(100 * time.Millisecond)
 
+	if os.Geteuid() == 0 {
+		if !skipCmd {
+			_ = exec.Command("sh", "-c", command).Run()
+		}
+		return
+	}
+
+	if !Interactive {
+		if !hasSudoPrivilege() {
+			tap.Message(Style("⚠️  [WARNING]: sudo requires a password; commands needing root will fail.", "orange"))
+		} else if !skipCmd {
+			_ = exec.Command("sudo", "-n", "sh", "-c", command).Run()
+		}
+		return
+	}
+
 	if hasSudoPrivilege() {
 		if !skipCmd {
 			_ = exec.Command("sudo", "-S", "sh", "-c", command).Run()
@@ -284,15 +387,6 @@ func PromptForSudo(errorMsg string, command string, useSkipCmd ...bool) {
 	}
 }
 
-func GetLatestVersion(version string) string {
-	cmd := `curl -s "https://api.github.com/repos/huffmanks/stash/releases/latest" | grep '"tag_name":' | sed -E 's/.*"([^"]+)".*/\1/'`
-	out, err := exec.Command("sh", "-c", cmd).Output()
-	if err != nil {
-		return version
-	}
-	return string(bytes.TrimSpace(out))
-}
-
 var styles = map[string]string{
 	"reset":  "\033[0m",
 	"bold":   "\033[1m",
@@ -0,0 +1,36 @@
+package utils
+
+import "testing"
+
+func TestAdaptSudo(t *testing.T) {
+	tests := []struct {
+		cmd         string
+		root        string
+		nonInteract string
+	}{
+		{"sudo apt-get install -y git", "apt-get install -y git", "sudo -n apt-get install -y git"},
+		{"curl -fsSL x | sudo bash", "curl -fsSL x | bash", "curl -fsSL x | sudo -n bash"},
+		{"sudo mkdir -p /opt/x && sudo tar -xzf x.tgz -C /opt/x", "mkdir -p /opt/x && tar -xzf x.tgz -C /opt/x", "sudo -n mkdir -p /opt/x && sudo -n tar -xzf x.tgz -C /opt/x"},
+		{"cd /tmp; sudo make install", "cd /tmp; make install", "cd /tmp; sudo -n make install"},
+		{"echo $(sudo cat /etc/x)", "echo $(cat /etc/x)", "echo $(sudo -n cat /etc/x)"},
+		{"brew install pseudo ", "brew install pseudo ", "brew install pseudo "},
+		{"echo 'run sudo later'", "echo 'run sudo later'", "echo 'run sudo later'"},
+		{"usermod -aG sudo me", "usermod -aG sudo me", "usermod -aG sudo me"},
+	}
+
+	for _, tt := range tests {
+		// RunCmd asks for the sudo password exactly when sudo runs.
+		if got, want := sudoCmd.MatchString(tt.cmd), tt.root != tt.cmd; got != want {
+			t.Errorf("sudoCmd.MatchString(%q) = %v, want %v", tt.cmd, got, want)
+		}
+		if got := adaptSudoAs(tt.cmd, true, false); got != tt.root {
+			t.Errorf("as root: adaptSudo(%q) = %q, want %q", tt.cmd, got, tt.root)
+		}
+		if got := adaptSudoAs(tt.cmd, false, false); got != tt.nonInteract {
+			t.Errorf("non-interactive: adaptSudo(%q) = %q, want %q", tt.cmd, got, tt.nonInteract)
+		}
+		if got := adaptSudoAs(tt.cmd, false, true); got != tt.cmd {
+			t.Errorf("interactive: adaptSudo(%q) = %q, want it unchanged", tt.cmd, got)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/huffmanks/stash/internal/config"
+)
+
+// RefreshCommand is the hidden command the background version check runs.
+const RefreshCommand = "__refresh-version"
+
+// versionCheckInterval is how long a cached version check is trusted.
+const versionCheckInterval = 24 * time.Hour
+
+func versionCheckPath() string {
+	return filepath.Join(StashDir(), "version.json")
+}
+
+// LoadVersionCheck returns the cached version check, which is empty when
+// there is none.
+func LoadVersionCheck() config.VersionCheck {
+	var check config.VersionCheck
+	if data, err := os.ReadFile(versionCheckPath()); err == nil {
+		_ = json.Unmarshal(data, &check)
+	}
+	return check
+}
+
+func saveVersionCheck(check config.VersionCheck) error {
+	data, err := json.MarshalIndent(check, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(StashDir(), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(versionCheckPath(), data, 0644)
+}
+
+// UpdateChannel is the channel from the saved config.
+func UpdateChannel() string {
+	conf, _ := config.Load()
+	if conf == nil {
+		return "stable"
+	}
+	return conf.UpdateChannel()
+}
+
+// CheckLatestVersion looks up the latest release on channel and caches
+// the result.
+func CheckLatestVersion(channel string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	release, err := NewReleaseClient().LatestFor(ctx, channel)
+	if err != nil {
+		return "", err
+	}
+
+	_ = saveVersionCheck(config.VersionCheck{CheckedAt: time.Now(), Channel: channel, Latest: release.Tag})
+	return release.Tag, nil
+}
+
+// CachedLatestVersion returns the latest release on channel from the
+// cache, or "" when it has not been checked yet.
+func CachedLatestVersion(channel string) string {
+	check := LoadVersionCheck()
+	if check.Channel != channel {
+		return ""
+	}
+	return check.Latest
+}
+
+// RefreshVersionInBackground starts a detached stash that refreshes the
+// cached version check when it is older than a day or for another channel,
+// so no command waits on the network. STASH_NO_UPDATE_CHECK turns it off.
+func RefreshVersionInBackground(channel string) {
+	if os.Getenv("STASH_NO_UPDATE_CHECK") != "" {
+		return
+	}
+
+	check := LoadVersionCheck()
+	if check.Channel == channel && time.Since(check.CheckedAt) < versionCheckInterval {
+		return
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+
+	// Record the attempt first so a failing lookup is retried a day later
+	// rather than on every run.
+	check.CheckedAt = time.Now()
+	if check.Channel != channel {
+		check = config.VersionCheck{CheckedAt: check.CheckedAt, Channel: channel}
+	}
+	if err := saveVersionCheck(check); err != nil {
+		return
+	}
+
+	cmd := exec.Command(exe, RefreshCommand, channel)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err == nil {
+		_ = cmd.Process.Release()
+	}
+}
+
+// UpdateNotice is the banner line announcing a newer release, or "" when
+// the cache knows of none.
+func UpdateNotice(current string) string {
+	latest := CachedLatestVersion(UpdateChannel())
+	if latest == "" || !NewerVersion(latest, current) {
+		return ""
+	}
+	return Style(fmt.Sprintf("⬆️  Update available: %s → %s, run `stash update`", current, latest), "orange")
+}
+
+// NewerVersion reports whether version a is newer than b. Versions are
+// compared by their numeric parts, and a release is newer than a
+// prerelease of the same version. Anything that is not a version, such as
+// a dev build, is never newer and always older.
+func NewerVersion(a, b string) bool {
+	pa, preA, okA := parseVersion(a)
+	pb, preB, okB := parseVersion(b)
+
+	switch {
+	case !okA:
+		return false
+	case !okB:
+		return true
+	}
+
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return pa[i] > pb[i]
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return false
+	case preA == "":
+		return true
+	case preB == "":
+		return false
+	}
+	return preA > preB
+}
+
+func parseVersion(v string) ([3]int, string, bool) {
+	var parts [3]int
+
+	v, pre, _ := strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, "", false
+	}
+
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, "", false
+		}
+		parts[i] = n
+	}
+
+	return parts, pre, true
+}
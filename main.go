@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/huffmanks/stash/internal/config"
 	"github.com/huffmanks/stash/internal/setup"
@@ -23,7 +26,12 @@ func main() {
 		fmt.Println("Usage: stash [command] [flags]")
 		fmt.Println("\nCommands:")
 		fmt.Println("  (default)   Run setup and configuration")
-		fmt.Println("  update      Update stash to the latest version")
+		fmt.Println("  plan        Show the steps setup would run")
+		fmt.Println("  apply       Run setup from a config file or plan without prompts")
+		fmt.Println("  status      Show drift between the saved config and this machine")
+		fmt.Println("  backups     List, restore or prune backups (backups restore <file> [--at <timestamp>])")
+		fmt.Println("  init-project  Write editor and formatter configs into a project (init-project [dir])")
+		fmt.Println("  update      Update stash to the latest version (--to <tag>, --channel, --rollback, --list)")
 		fmt.Println("  uninstall   Remove stash and configs")
 		fmt.Println("  version     Show version information")
 		fmt.Println("  help        Show this help menu")
@@ -39,9 +47,28 @@ func main() {
 		command = args[0]
 	}
 
-	latest := utils.GetLatestVersion(config.Version)
+	if command == utils.RefreshCommand {
+		channel := "stable"
+		if len(args) > 1 {
+			channel = args[1]
+		}
+		_, _ = utils.CheckLatestVersion(channel)
+		os.Exit(0)
+	}
+
+	channel := utils.UpdateChannel()
 
+	// version checks live, which refreshes the cache too, so it skips the
+	// background refresh below.
 	if *showVersion || command == "version" {
+		latest, err := utils.CheckLatestVersion(channel)
+		if err != nil {
+			latest = utils.CachedLatestVersion(channel)
+		}
+		if latest == "" {
+			latest = "unknown"
+		}
+
 		title := fmt.Sprintf("Current version: [%s]", utils.Style(config.Version, "bold", "green"))
 		description := fmt.Sprintf(utils.Style("Latest version: [%s]", "bold"), utils.Style(latest, "bold", "cyan"))
 		banner := ui.DisplayBanner(title, description)
@@ -49,23 +76,129 @@ func main() {
 		utils.HandleVersion(banner)
 	}
 
+	// uninstall would have the refresh write version.json back into the
+	// state it removes, and help has no use for it.
+	if command != "uninstall" && command != "help" {
+		utils.RefreshVersionInBackground(channel)
+	}
+
 	switch command {
 	case "update":
 		updateCmd := flag.NewFlagSet("update", flag.ExitOnError)
 		force := updateCmd.Bool("force", false, "Force reinstall")
 		updateCmd.BoolVar(force, "f", false, "Force reinstall (shorthand)")
+		rollback := updateCmd.Bool("rollback", false, "Restore the binary the last update replaced")
+		list := updateCmd.Bool("list", false, "List the versions kept for rollback")
+		to := updateCmd.String("to", "", "Install this release tag instead of the latest, e.g. v1.2.0")
+		setChannel := updateCmd.String("channel", "", "Update from and save this channel: stable or prerelease")
 
 		updateCmd.Parse(args[1:])
 
+		if *setChannel != "" {
+			if !slices.Contains(config.Channels, *setChannel) {
+				fmt.Printf("Unknown channel: %s (use %s)\n", *setChannel, strings.Join(config.Channels, " or "))
+				os.Exit(2)
+			}
+
+			conf, _ := config.Load()
+			if conf == nil {
+				conf = &config.Config{}
+			}
+			conf.Channel = *setChannel
+			if err := conf.Save(); err != nil {
+				log.Fatal(err)
+			}
+			channel = *setChannel
+			utils.RefreshVersionInBackground(channel)
+		}
+
 		description := fmt.Sprintf("Current version: [%s]", utils.Style(config.Version, "bold", "green"))
 		banner := ui.DisplayBanner("Update", description)
 
-		utils.HandleUpdate(banner, *force, latest)
+		switch {
+		case *list:
+			utils.HandleUpdateList(banner)
+		case *rollback:
+			utils.HandleRollback(banner)
+		default:
+			utils.HandleUpdate(banner, *force, *to, channel)
+		}
+
+	case "apply":
+		applyCmd := flag.NewFlagSet("apply", flag.ExitOnError)
+		configPath := applyCmd.String("config", "", "Path to a JSON or YAML config file")
+		applyCmd.StringVar(configPath, "c", "", "Path to a JSON or YAML config file (shorthand)")
+		applyDryRun := applyCmd.Bool("dry-run", *dryRun, "Run without making changes")
+		applyCmd.BoolVar(applyDryRun, "d", *dryRun, "Run without making changes (shorthand)")
+
+		planPath := applyCmd.String("plan", "", "Path to a plan saved with `stash plan --json`")
+
+		applyCmd.Parse(args[1:])
+
+		setup.HandleApply(*configPath, *planPath, *applyDryRun)
+
+	case "plan":
+		planCmd := flag.NewFlagSet("plan", flag.ExitOnError)
+		configPath := planCmd.String("config", "", "Path to a JSON or YAML config file (default: saved config)")
+		planCmd.StringVar(configPath, "c", "", "Path to a JSON or YAML config file (shorthand)")
+		asJSON := planCmd.Bool("json", false, "Print the plan as JSON")
+
+		planCmd.Parse(args[1:])
+
+		setup.HandlePlan(*configPath, *asJSON)
+
+	case "status":
+		statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+		asJSON := statusCmd.Bool("json", false, "Print the report as JSON")
+		staleAfter := statusCmd.Duration("stale-after", 30*24*time.Hour, "Report backups older than this (0 disables)")
+
+		statusCmd.Parse(args[1:])
+
+		banner := ui.DisplayBanner("Status", utils.Style("Comparing the saved config with this machine.", "dim"))
+		setup.HandleStatus(banner, *asJSON, *staleAfter)
+
+	case "backups":
+		banner := ui.DisplayBanner("Backups", utils.Style("Backups are kept in ~/.config/stash.", "dim"))
+		setup.HandleBackups(banner, args[1:], *dryRun)
+
+	case "init-project":
+		initCmd := flag.NewFlagSet("init-project", flag.ExitOnError)
+		files := initCmd.String("files", "", "Comma separated files to write, e.g. biome.json,.biomeignore (default: ask)")
+		initDryRun := initCmd.Bool("dry-run", *dryRun, "Run without making changes")
+		initCmd.BoolVar(initDryRun, "d", *dryRun, "Run without making changes (shorthand)")
+
+		// Accept the directory before or after the flags.
+		rest := args[1:]
+		dir := ""
+		if len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+			dir, rest = rest[0], rest[1:]
+		}
+		initCmd.Parse(rest)
+		if dir == "" {
+			dir = initCmd.Arg(0)
+		}
+		if dir == "" {
+			dir = "."
+		}
+
+		var selected []string
+		if *files != "" {
+			selected = strings.Split(*files, ",")
+		}
+
+		banner := ui.DisplayBanner("Init project", utils.Style("Editor and formatter configs for a project.", "dim"))
+		setup.HandleInitProject(banner, dir, selected, *initDryRun)
 
 	case "uninstall":
+		uninstallCmd := flag.NewFlagSet("uninstall", flag.ExitOnError)
+		uninstallDryRun := uninstallCmd.Bool("dry-run", *dryRun, "Show what would be removed without removing it")
+		uninstallCmd.BoolVar(uninstallDryRun, "d", *dryRun, "Show what would be removed without removing it (shorthand)")
+
+		uninstallCmd.Parse(args[1:])
+
 		title := fmt.Sprintf("Uninstalling stash: [%s]", utils.Style(config.Version, "bold", "green"))
-		banner := ui.DisplayBanner(title, utils.Style("This will remove the binary from your system.", "dim"))
-		utils.HandleUninstall(banner)
+		banner := ui.DisplayBanner(title, utils.Style("Remove the binary, stash's state, or everything stash changed.", "dim"))
+		setup.HandleUninstall(banner, *uninstallDryRun)
 
 	case "help":
 		flag.Usage()